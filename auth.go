@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// contextKey is the type of the keys this package stores in a request context.
+// Using an own type instead of a plain string means the keys can never clash
+// with keys from other packages, even if they have the same name.
+type contextKey string
+
+const claimsKey contextKey = "claims"
+
+func jwtAuthMiddleware(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			/*
+				Without a secret every token would be checked against an empty key,
+				which anyone can sign with, so the request is refused instead.
+			*/
+			if len(secret) == 0 {
+				writeAPIError(w, r, http.StatusInternalServerError, "auth_not_configured", "authentication is not configured")
+				return
+			}
+
+			/*
+				The client sends the token in the header "Authorization: Bearer <token>".
+				WWW-Authenticate tells the client which kind of authentication is
+				expected when the token is missing or not valid.
+			*/
+			tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || tokenString == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, http.StatusUnauthorized, "missing_token", "missing bearer token")
+				return
+			}
+
+			/*
+				jwt.Parse checks the signature with the key returned by the function
+				and that the token hasn't expired. Only HMAC algorithms are allowed,
+				otherwise a token could pick an algorithm that ignores our secret.
+			*/
+			claims := jwt.MapClaims{}
+			_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+				return secret, nil
+			}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}), jwt.WithExpirationRequired())
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					writeError(w, r, http.StatusUnauthorized, "token_expired", "token has expired")
+					return
+				}
+				writeError(w, r, http.StatusUnauthorized, "invalid_token", "invalid token")
+				return
+			}
+
+			// The claims are stored in the request context, so handlers can read them with claimsFrom
+			ctx := context.WithValue(r.Context(), claimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requireAuth wraps a single handler in jwtAuthMiddleware, so only the routes
+// that use it need a token and every other route stays public.
+func requireAuth(secret []byte, h http.HandlerFunc) http.Handler {
+	return jwtAuthMiddleware(secret)(h)
+}
+
+// claimsFrom returns the claims jwtAuthMiddleware stored in ctx.
+func claimsFrom(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+// tokenLifetime is how long a token from POST /login is valid.
+const tokenLifetime = time.Hour
+
+// loginInput is the JSON body accepted by POST /login.
+type loginInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// login gives out tokens to the one user set with LOGIN_USER and LOGIN_PASS.
+// A real API would look the user up in a database and store a hash of the
+// password instead of the password.
+func login(secret []byte, username, password string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		/*
+			Without a secret the token couldn't be checked later, and without a
+			user there is nobody to log in, so in both cases no token is given out.
+		*/
+		if len(secret) == 0 || username == "" {
+			writeAPIError(w, r, http.StatusInternalServerError, "auth_not_configured", "authentication is not configured")
+			return
+		}
+
+		var input loginInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			if err == io.EOF {
+				writeAPIError(w, r, http.StatusBadRequest, "missing_credentials", "username and password are required")
+				return
+			}
+			writeDecodeError(w, r, err)
+			return
+		}
+
+		if !credentialsMatch(input.Username, input.Password, username, password) {
+			writeError(w, r, http.StatusUnauthorized, "invalid_credentials", "invalid username or password")
+			return
+		}
+
+		/*
+			The claims are the data inside the token: sub (subject) is who the token
+			belongs to, iat when it was issued and exp when it expires. Signing them
+			with the secret means nobody can change them without the signature
+			breaking, which jwtAuthMiddleware checks.
+		*/
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": input.Username,
+			"iat": now.Unix(),
+			"exp": now.Add(tokenLifetime).Unix(),
+		})
+		signed, err := token.SignedString(secret)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "could not create token")
+			return
+		}
+
+		writeSuccess(w, r, http.StatusOK, map[string]interface{}{
+			"token":      signed,
+			"token_type": "Bearer",
+			"expires_in": int(tokenLifetime.Seconds()),
+		})
+	}
+}
+
+func me(w http.ResponseWriter, r *http.Request) {
+	// This handler is only reached through requireAuth, so the claims are always there
+	claims, _ := claimsFrom(r.Context())
+	writeSuccess(w, r, http.StatusOK, map[string]interface{}{"claims": claims})
+}
+
+func basicAuthMiddleware(username, password string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Like with JWT_SECRET, no credentials configured means nobody gets in
+			if username == "" {
+				writeAPIError(w, r, http.StatusInternalServerError, "auth_not_configured", "authentication is not configured")
+				return
+			}
+
+			/*
+				r.BasicAuth reads the username and password from the header
+				"Authorization: Basic <base64 of username:password>". The
+				WWW-Authenticate header makes browsers show a login dialog.
+			*/
+			user, pass, ok := r.BasicAuth()
+			if !ok || !credentialsMatch(user, pass, username, password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+				writeError(w, r, http.StatusUnauthorized, "invalid_credentials", "invalid username or password")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func credentialsMatch(user, pass, username, password string) bool {
+	/*
+		A normal == stops at the first character that differs, so by timing the
+		responses an attacker could guess the password one character at a time.
+		subtle.ConstantTimeCompare always takes the same time, but only for
+		inputs of the same length, which is why the hashes are compared instead.
+		Both comparisons always run, so a wrong username takes as long as a
+		wrong password.
+	*/
+	userHash, usernameHash := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(username))
+	passHash, passwordHash := sha256.Sum256([]byte(pass)), sha256.Sum256([]byte(password))
+
+	userMatch := subtle.ConstantTimeCompare(userHash[:], usernameHash[:])
+	passMatch := subtle.ConstantTimeCompare(passHash[:], passwordHash[:])
+	return userMatch&passMatch == 1
+}
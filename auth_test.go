@@ -0,0 +1,306 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signToken returns a token for claims signed with secret.
+func signToken(t *testing.T, secret []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// serveWithToken sends a GET request to h, with the token as bearer token
+// unless it is empty.
+func serveWithToken(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/me", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	secret := []byte("test-secret")
+	h := requireAuth(secret, me)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		token    string
+		status   int
+		wantCode string
+	}{
+		{
+			name:   "valid",
+			token:  signToken(t, secret, jwt.MapClaims{"sub": "yoda", "exp": now.Add(time.Minute).Unix()}),
+			status: http.StatusOK,
+		},
+		{
+			name:     "expired",
+			token:    signToken(t, secret, jwt.MapClaims{"sub": "yoda", "exp": now.Add(-time.Minute).Unix()}),
+			status:   http.StatusUnauthorized,
+			wantCode: "token_expired",
+		},
+		{
+			name:     "missing",
+			status:   http.StatusUnauthorized,
+			wantCode: "missing_token",
+		},
+		{
+			name:     "other secret",
+			token:    signToken(t, []byte("other"), jwt.MapClaims{"sub": "yoda", "exp": now.Add(time.Minute).Unix()}),
+			status:   http.StatusUnauthorized,
+			wantCode: "invalid_token",
+		},
+		{
+			name:     "no expiry",
+			token:    signToken(t, secret, jwt.MapClaims{"sub": "yoda"}),
+			status:   http.StatusUnauthorized,
+			wantCode: "invalid_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveWithToken(h, tt.token)
+			if rec.Code != tt.status {
+				t.Fatalf("got %d, want %d\n%s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.wantCode == "" {
+				// The handler gets the claims from the context
+				var data struct {
+					Claims map[string]interface{} `json:"claims"`
+				}
+				decodeData(t, rec, &data)
+				if data.Claims["sub"] != "yoda" {
+					t.Errorf("got claims %v, want sub yoda", data.Claims)
+				}
+				return
+			}
+			if got := decodeError(t, rec).Code; got != tt.wantCode {
+				t.Errorf("got code %q, want %q", got, tt.wantCode)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("the 401 has no WWW-Authenticate header")
+			}
+		})
+	}
+
+	// Without a secret nobody gets in, not even with an unsigned token
+	rec := serveWithToken(requireAuth(nil, me), signToken(t, []byte{}, jwt.MapClaims{"exp": now.Add(time.Minute).Unix()}))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("no secret = %d, want 500", rec.Code)
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	h := basicAuthMiddleware("admin", "secret")(http.HandlerFunc(hello))
+
+	tests := []struct {
+		name       string
+		user, pass string
+		noAuth     bool
+		status     int
+	}{
+		{name: "missing", noAuth: true, status: http.StatusUnauthorized},
+		{name: "wrong password", user: "admin", pass: "guess", status: http.StatusUnauthorized},
+		{name: "wrong user", user: "root", pass: "secret", status: http.StatusUnauthorized},
+		{name: "empty", status: http.StatusUnauthorized},
+		{name: "correct", user: "admin", pass: "secret", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/stats", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if got := rec.Header().Get("WWW-Authenticate"); got != `Basic realm="admin", charset="UTF-8"` {
+					t.Errorf("WWW-Authenticate = %q", got)
+				}
+				if got := decodeError(t, rec).Code; got != "invalid_credentials" {
+					t.Errorf("got code %q, want invalid_credentials", got)
+				}
+			}
+		})
+	}
+
+	// Without credentials configured even an empty login is refused
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.SetBasicAuth("", "")
+	rec := httptest.NewRecorder()
+	basicAuthMiddleware("", "")(http.HandlerFunc(hello)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("no credentials configured = %d, want 500", rec.Code)
+	}
+}
+
+func TestResolveBasicAuth(t *testing.T) {
+	t.Setenv("ADMIN_USER", "admin")
+	t.Setenv("ADMIN_PASS", "secret")
+	if user, pass, err := resolveBasicAuth(); err != nil || user != "admin" || pass != "secret" {
+		t.Errorf("got %q, %q, %v", user, pass, err)
+	}
+
+	// One without the other is a mistake
+	t.Setenv("ADMIN_PASS", "")
+	if _, _, err := resolveBasicAuth(); err == nil {
+		t.Error("ADMIN_USER without ADMIN_PASS gave no error")
+	}
+}
+
+// loginToken logs in to router with the user from testServices and returns
+// the token.
+func loginToken(t *testing.T, router http.Handler) string {
+	t.Helper()
+	rec := serveRequest(router, "POST", "/login", `{"username": "yoda", "password": "do-or-do-not"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /login = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+	var data struct {
+		Token     string `json:"token"`
+		TokenType string `json:"token_type"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	decodeData(t, rec, &data)
+	if data.TokenType != "Bearer" || data.ExpiresIn != int(tokenLifetime.Seconds()) {
+		t.Errorf("got token type %q expiring in %d", data.TokenType, data.ExpiresIn)
+	}
+	return data.Token
+}
+
+func TestLoginTokens(t *testing.T) {
+	shared := testServices(t)
+	router := newV1Router(t, shared)
+
+	t.Run("valid", func(t *testing.T) {
+		if rec := serveWithToken(router, loginToken(t, router)); rec.Code != http.StatusOK {
+			t.Errorf("GET /me with the token from /login = %d, want 200", rec.Code)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token := signToken(t, shared.jwtSecret, jwt.MapClaims{"sub": "yoda", "exp": time.Now().Add(-time.Second).Unix()})
+		rec := serveWithToken(router, token)
+		if rec.Code != http.StatusUnauthorized || decodeError(t, rec).Code != "token_expired" {
+			t.Errorf("GET /me with an expired token = %d %s, want 401 token_expired", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		// Changing the claims breaks the signature, even if the claims are valid
+		signed := signToken(t, shared.jwtSecret, jwt.MapClaims{"sub": "luke", "exp": time.Now().Add(time.Hour).Unix()})
+		parts := strings.Split(loginToken(t, router), ".")
+		tampered := parts[0] + "." + strings.Split(signed, ".")[1] + "." + parts[2]
+
+		rec := serveWithToken(router, tampered)
+		if rec.Code != http.StatusUnauthorized || decodeError(t, rec).Code != "invalid_token" {
+			t.Errorf("GET /me with a tampered token = %d %s, want 401 invalid_token", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestLoginCredentials(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		wantCode string
+	}{
+		{name: "wrong password", body: `{"username": "yoda", "password": "try"}`, status: http.StatusUnauthorized, wantCode: "invalid_credentials"},
+		{name: "other user", body: `{"username": "luke", "password": "do-or-do-not"}`, status: http.StatusUnauthorized, wantCode: "invalid_credentials"},
+		{name: "no body", status: http.StatusBadRequest, wantCode: "missing_credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, "POST", "/login", tt.body)
+			if rec.Code != tt.status || decodeError(t, rec).Code != tt.wantCode {
+				t.Errorf("POST /login = %d %s, want %d %s", rec.Code, rec.Body, tt.status, tt.wantCode)
+			}
+		})
+	}
+
+	// There is no default user, so without LOGIN_USER nobody can log in
+	h := login([]byte("test-secret"), "", "")
+	rec := serveRequest(h, "POST", "/login", `{"username": "", "password": ""}`)
+	if rec.Code != http.StatusInternalServerError || decodeError(t, rec).Code != "auth_not_configured" {
+		t.Errorf("POST /login without a user = %d %s, want 500 auth_not_configured", rec.Code, rec.Body)
+	}
+}
+
+func TestResolveLoginCredentials(t *testing.T) {
+	t.Setenv("LOGIN_USER", "")
+	t.Setenv("LOGIN_PASS", "")
+	if user, _, err := resolveLoginCredentials(); err != nil || user != "" {
+		t.Errorf("without LOGIN_USER got %q, %v, want no user", user, err)
+	}
+
+	t.Setenv("LOGIN_USER", "yoda")
+	if _, _, err := resolveLoginCredentials(); err == nil {
+		t.Error("LOGIN_USER without LOGIN_PASS gave no error")
+	}
+
+	t.Setenv("LOGIN_PASS", "a-long-password")
+	if user, pass, err := resolveLoginCredentials(); err != nil || user != "yoda" || pass != "a-long-password" {
+		t.Errorf("got %q, %q, %v", user, pass, err)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, target := range []string{"/admin/stats", "/admin/routes", "/admin/metrics"} {
+		t.Run(target, func(t *testing.T) {
+			tests := []struct {
+				name       string
+				user, pass string
+				noAuth     bool
+				status     int
+			}{
+				{name: "correct", user: "admin", pass: "secret", status: http.StatusOK},
+				{name: "wrong", user: "admin", pass: "guess", status: http.StatusUnauthorized},
+				{name: "missing", noAuth: true, status: http.StatusUnauthorized},
+			}
+			for _, tt := range tests {
+				req := httptest.NewRequest("GET", target, nil)
+				if !tt.noAuth {
+					req.SetBasicAuth(tt.user, tt.pass)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != tt.status {
+					t.Errorf("%s credentials: got %d, want %d", tt.name, rec.Code, tt.status)
+				}
+				if got := rec.Header().Get("WWW-Authenticate"); (got != "") != (tt.status == http.StatusUnauthorized) {
+					t.Errorf("%s credentials: WWW-Authenticate = %q", tt.name, got)
+				}
+			}
+		})
+	}
+
+	// The routes outside /admin don't ask for a password
+	if rec := serveRequest(router, "GET", "/routes", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /routes without credentials = %d, want 200", rec.Code)
+	}
+}
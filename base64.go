@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+)
+
+func base64Encoding(r *http.Request) *base64.Encoding {
+	/*
+		Standard base64 uses + and / which have a special meaning in urls, so
+		with ?url=true the url-safe alphabet, which uses - and _ instead, is used.
+	*/
+	if r.URL.Query().Get("url") == "true" {
+		return base64.URLEncoding
+	}
+	return base64.StdEncoding
+}
+
+func base64Encode(w http.ResponseWriter, r *http.Request) {
+	// The body is limited by maxBodyBytesMiddleware, so it can be read in one go
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(base64Encoding(r).EncodeToString(body)))
+}
+
+func base64Decode(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return
+	}
+
+	/*
+		Spaces and newlines around the text aren't part of the base64, e.g. the
+		newline at the end of a file, so they are removed before decoding.
+	*/
+	decoded, err := base64Encoding(r).DecodeString(string(bytes.TrimSpace(body)))
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_base64", "invalid base64: "+err.Error())
+		return
+	}
+
+	/*
+		The decoded bytes can be anything, like an image, so they are sent as
+		octet-stream (raw bytes) instead of guessing what they are.
+	*/
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(decoded)
+}
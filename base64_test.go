@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBase64RoundTrip(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	// \xfb\xff encodes to characters that differ between the two alphabets
+	input := "Do or do not\xfb\xff"
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "RG8gb3IgZG8gbm90+/8="},
+		{query: "?url=true", want: "RG8gb3IgZG8gbm90-_8="},
+	}
+	for _, tt := range tests {
+		t.Run("encode"+tt.query, func(t *testing.T) {
+			rec := serveRequest(router, "POST", "/base64/encode"+tt.query, input)
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+				t.Fatalf("POST /base64/encode%s = %d %q, want %q", tt.query, rec.Code, rec.Body, tt.want)
+			}
+
+			// A newline at the end, like from a file, is ignored
+			rec = serveRequest(router, "POST", "/base64/decode"+tt.query, rec.Body.String()+"\n")
+			if rec.Code != http.StatusOK || rec.Body.String() != input {
+				t.Errorf("POST /base64/decode%s = %d %q, want the input back", tt.query, rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/octet-stream" {
+				t.Errorf("decoded Content-Type is %q", got)
+			}
+		})
+	}
+}
+
+func TestBase64DecodeInvalid(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		name  string
+		query string
+		body  string
+	}{
+		{name: "not base64", body: "not base64!"},
+		{name: "bad padding", body: "RG8"},
+		{name: "url alphabet without url=true", body: "RG8gb3IgZG8gbm90-_8="},
+		{name: "standard alphabet with url=true", query: "?url=true", body: "RG8gb3IgZG8gbm90+/8="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, "POST", "/base64/decode"+tt.query, tt.body)
+			if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_base64" {
+				t.Errorf("decoding %q = %d %s, want 400 invalid_base64", tt.body, rec.Code, rec.Body)
+			}
+		})
+	}
+}
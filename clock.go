@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	// time/tzdata puts the timezone database inside the program, so
+	// time.LoadLocation also works on systems that don't have it installed.
+	_ "time/tzdata"
+)
+
+func getTime(w http.ResponseWriter, r *http.Request) {
+	/*
+		The tz query parameter is the name of a timezone from the IANA database,
+		e.g. Europe/Copenhagen or America/New_York. Without it the time is in UTC.
+	*/
+	location := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_timezone", "unknown timezone "+tz+", use a name like Europe/Copenhagen")
+			return
+		}
+	}
+
+	/*
+		In converts the time to the timezone. RFC 3339 is the common format for
+		times in APIs, e.g. 2006-01-02T15:04:05+01:00, and Unix is the number of
+		seconds since January 1st 1970 UTC, which is the same in every timezone.
+		"time" is the same as "local" and is kept for clients that already use it.
+	*/
+	now := time.Now()
+	local := now.In(location).Format(time.RFC3339)
+	writeSuccess(w, r, http.StatusOK, map[string]interface{}{
+		"utc":      now.UTC().Format(time.RFC3339),
+		"local":    local,
+		"time":     local,
+		"timezone": location.String(),
+		"unix":     now.Unix(),
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timeResponse is the data of GET /time.
+type timeResponse struct {
+	UTC      string `json:"utc"`
+	Local    string `json:"local"`
+	Time     string `json:"time"`
+	Timezone string `json:"timezone"`
+	Unix     int64  `json:"unix"`
+}
+
+func TestTimeDefaultsToUTC(t *testing.T) {
+	before := time.Now().Unix()
+	rec := serveRequest(http.HandlerFunc(getTime), "GET", "/time", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /time = %d, want 200", rec.Code)
+	}
+
+	var data timeResponse
+	decodeData(t, rec, &data)
+	if data.Timezone != "UTC" || data.Time != data.UTC {
+		t.Errorf("got %+v, want UTC", data)
+	}
+	parsed, err := time.Parse(time.RFC3339, data.Time)
+	if err != nil {
+		t.Fatalf("time %q is not RFC 3339: %v", data.Time, err)
+	}
+	if parsed.Unix() != data.Unix || data.Unix < before || data.Unix > time.Now().Unix() {
+		t.Errorf("time %s and unix %d don't match the current time", data.Time, data.Unix)
+	}
+}
+
+func TestTimeInZone(t *testing.T) {
+	rec := serveRequest(http.HandlerFunc(getTime), "GET", "/time?tz=Europe/Copenhagen", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /time?tz=Europe/Copenhagen = %d, want 200", rec.Code)
+	}
+
+	var data timeResponse
+	decodeData(t, rec, &data)
+	location, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := time.Parse(time.RFC3339, data.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// It is the same moment, only the offset differs
+	_, wantOffset := time.Unix(data.Unix, 0).In(location).Zone()
+	if _, offset := local.Zone(); offset != wantOffset || local.Unix() != data.Unix {
+		t.Errorf("local time %s, want the time %d in Copenhagen", data.Local, data.Unix)
+	}
+	if data.Timezone != "Europe/Copenhagen" || data.Time != data.Local {
+		t.Errorf("got %+v", data)
+	}
+}
+
+func TestTimeInvalidZone(t *testing.T) {
+	for _, tz := range []string{"Mars/Olympus_Mons", "../etc/passwd"} {
+		rec := serveRequest(http.HandlerFunc(getTime), "GET", "/time?tz="+tz, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_timezone" {
+			t.Errorf("GET /time?tz=%s = %d %s, want 400 invalid_timezone", tz, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestTimeUTCAndLocal(t *testing.T) {
+	tests := []struct {
+		tz         string
+		wantOffset string
+		wantZone   string
+	}{
+		{tz: "", wantOffset: "Z", wantZone: "UTC"},
+		{tz: "Asia/Kolkata", wantOffset: "+05:30", wantZone: "Asia/Kolkata"},
+		{tz: "Etc/GMT+10", wantOffset: "-10:00", wantZone: "Etc/GMT+10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantZone, func(t *testing.T) {
+			// + is a space in a query, so it has to be escaped
+			rec := serveRequest(http.HandlerFunc(getTime), "GET", "/time?tz="+url.QueryEscape(tt.tz), "")
+			var data timeResponse
+			decodeData(t, rec, &data)
+
+			if !strings.HasSuffix(data.UTC, "Z") || !strings.HasSuffix(data.Local, tt.wantOffset) || data.Timezone != tt.wantZone {
+				t.Errorf("got utc %s, local %s in %s, want the offset %s in %s", data.UTC, data.Local, data.Timezone, tt.wantOffset, tt.wantZone)
+			}
+
+			// utc and local are the same moment written in two ways
+			utc, err1 := time.Parse(time.RFC3339, data.UTC)
+			local, err2 := time.Parse(time.RFC3339, data.Local)
+			if err1 != nil || err2 != nil || !utc.Equal(local) {
+				t.Errorf("utc %s and local %s are not the same time", data.UTC, data.Local)
+			}
+		})
+	}
+
+	rec := serveRequest(http.HandlerFunc(getTime), "GET", "/time?tz=America/Gotham", "")
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusBadRequest || !strings.Contains(apiErr.Message, "America/Gotham") {
+		t.Errorf("an unknown timezone = %d %+v, want 400 naming it", rec.Code, apiErr)
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the server. Each setting can come from four
+// places, where a later one wins over an earlier one: the defaults from
+// defaultConfig, the config file given with -config, environment variables
+// and command-line flags. The tags are the names used in the config file.
+//
+// Secrets like JWT_SECRET, ADMIN_PASS and LOGIN_PASS are only read from the
+// environment, so they don't end up in a file that might be committed to git.
+type Config struct {
+	Addr                  string   `json:"addr" yaml:"addr"`
+	Port                  int      `json:"port" yaml:"port"`
+	TLSCertFile           string   `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile            string   `json:"tls_key_file" yaml:"tls_key_file"`
+	CORSOrigins           []string `json:"cors_origins" yaml:"cors_origins"`
+	RateLimitRPS          float64  `json:"rate_limit_rps" yaml:"rate_limit_rps"`
+	RateLimitBurst        int      `json:"rate_limit_burst" yaml:"rate_limit_burst"`
+	MaxBodyBytes          int64    `json:"max_body_bytes" yaml:"max_body_bytes"`
+	MaxPrintBytes         int      `json:"max_print_bytes" yaml:"max_print_bytes"`
+	MaxUploadBytes        int64    `json:"max_upload_bytes" yaml:"max_upload_bytes"`
+	RequestTimeout        duration `json:"request_timeout" yaml:"request_timeout"`
+	ReadTimeout           duration `json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout     duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout          duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout           duration `json:"idle_timeout" yaml:"idle_timeout"`
+	EnablePprof           bool     `json:"enable_pprof" yaml:"enable_pprof"`
+	UploadDir             string   `json:"upload_dir" yaml:"upload_dir"`
+	StaticDir             string   `json:"static_dir" yaml:"static_dir"`
+	DBPath                string   `json:"db_path" yaml:"db_path"`
+	UpstreamURL           string   `json:"upstream_url" yaml:"upstream_url"`
+	ProblemJSON           bool     `json:"problem_json" yaml:"problem_json"`
+	TrustProxy            bool     `json:"trust_proxy" yaml:"trust_proxy"`
+	LogBodies             bool     `json:"log_bodies" yaml:"log_bodies"`
+	ContentSecurityPolicy string   `json:"content_security_policy" yaml:"content_security_policy"`
+
+	// addrSource tells where the address came from, so it can be printed at startup
+	addrSource string
+}
+
+// duration is a time.Duration that is written as text like "15s" in the
+// config file. Both the json and yaml packages call UnmarshalText for it.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = value
+	return nil
+}
+
+// defaultPort is the port the server listens on when nothing else is configured.
+const defaultPort = 5000
+
+// Default rate limit for each client, see applyEnv.
+const (
+	defaultRateLimitRPS   = 10
+	defaultRateLimitBurst = 20
+)
+
+// defaultMaxBodyBytes is the largest request body accepted by default, 1 MiB.
+const defaultMaxBodyBytes = 1 << 20
+
+// defaultMaxPrintBytes is the longest text /print echoes back by default.
+const defaultMaxPrintBytes = 4096
+
+// defaultMaxUploadBytes is the largest file POST /upload stores by default, 1 MiB.
+const defaultMaxUploadBytes = 1 << 20
+
+// defaultContentSecurityPolicy only lets pages load scripts, styles and
+// images from this server, see securityHeadersMiddleware. The landing page
+// and Swagger UI need inline styles and data: images.
+const defaultContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; frame-ancestors 'none'"
+
+// defaultRequestTimeout is how long a handler may take before the client gets a 503.
+const defaultRequestTimeout = 15 * time.Second
+
+func defaultConfig() *Config {
+	/*
+		A client gets 15 seconds to send its request, of which the headers may
+		take 5, since a normal client sends them right away. The write timeout
+		is a bit longer than defaultRequestTimeout, so a handler that times out
+		can still send its 503 response. A kept-alive connection without new
+		requests is closed after 60 seconds. With no CORS origins configured,
+		every origin is allowed.
+	*/
+	return &Config{
+		Port:                  defaultPort,
+		CORSOrigins:           []string{"*"},
+		RateLimitRPS:          defaultRateLimitRPS,
+		RateLimitBurst:        defaultRateLimitBurst,
+		MaxBodyBytes:          defaultMaxBodyBytes,
+		MaxPrintBytes:         defaultMaxPrintBytes,
+		MaxUploadBytes:        defaultMaxUploadBytes,
+		RequestTimeout:        duration{defaultRequestTimeout},
+		ReadTimeout:           duration{15 * time.Second},
+		ReadHeaderTimeout:     duration{5 * time.Second},
+		WriteTimeout:          duration{20 * time.Second},
+		IdleTimeout:           duration{60 * time.Second},
+		UploadDir:             "uploads",
+		StaticDir:             "public",
+		ContentSecurityPolicy: defaultContentSecurityPolicy,
+		addrSource:            "default",
+	}
+}
+
+// flags holds the values of the command-line flags, see main. An empty string
+// (or false) means the flag wasn't given.
+type flags struct {
+	config    string
+	addr      string
+	port      string
+	tlsCert   string
+	tlsKey    string
+	staticDir string
+	pprof     bool
+}
+
+func resolveConfig(f flags) (*Config, error) {
+	/*
+		Each step only changes the settings it has a value for, so whatever is
+		left unset keeps the value from the step before.
+	*/
+	cfg, err := loadConfig(f.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.applyFlags(f); err != nil {
+		return nil, err
+	}
+
+	// Only one of the two is almost certainly a mistake, so we stop right away
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("both a TLS certificate and key are needed to serve HTTPS, got certificate %q and key %q", cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+	return cfg, nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	/*
+		The config file is optional, without one the defaults are used. The
+		settings in the file are decoded on top of the defaults, so the file only
+		needs the settings that should be different.
+	*/
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	// The extension of the file decides if it's read as JSON or YAML
+	addrBefore, portBefore := cfg.Addr, cfg.Port
+	switch filepath.Ext(path) {
+	case ".json":
+		// DisallowUnknownFields turns a misspelled setting into an error instead of ignoring it
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		// KnownFields does the same for YAML. An empty file gives io.EOF, which is fine
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(cfg); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	default:
+		return nil, fmt.Errorf("config file %s must end with .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if cfg.Addr != addrBefore || cfg.Port != portBefore {
+		cfg.addrSource = "config file"
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// validate checks the settings from the config file. Environment variables
+// and flags are checked when they are read, so their errors can name them.
+func (c *Config) validate() error {
+	if c.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+			return fmt.Errorf("addr %q must be in the form host:port", c.Addr)
+		}
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port %d must be a number between 1 and 65535", c.Port)
+	}
+	if c.RateLimitRPS <= 0 || c.RateLimitBurst < 1 {
+		return fmt.Errorf("rate_limit_rps and rate_limit_burst must be above 0")
+	}
+	if c.MaxBodyBytes < 1 || c.MaxPrintBytes < 1 || c.MaxUploadBytes < 1 {
+		return fmt.Errorf("max_body_bytes, max_print_bytes and max_upload_bytes must be above 0")
+	}
+	if c.UploadDir == "" || c.StaticDir == "" {
+		return fmt.Errorf("upload_dir and static_dir must not be empty")
+	}
+	if c.RequestTimeout.Duration <= 0 || c.ReadTimeout.Duration <= 0 || c.ReadHeaderTimeout.Duration <= 0 || c.WriteTimeout.Duration <= 0 || c.IdleTimeout.Duration <= 0 {
+		return fmt.Errorf("timeouts must be a duration above 0 like 15s")
+	}
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	/*
+		The PORT environment variable is how most process managers, containers
+		and hosting platforms tell a program where to listen. It replaces an addr
+		from the config file, because environment variables win over the file.
+		An empty value counts as not set, for all variables.
+	*/
+	if value := os.Getenv("PORT"); value != "" {
+		port, err := parsePort("PORT", value)
+		if err != nil {
+			return err
+		}
+		c.Port, c.Addr, c.addrSource = port, "", "PORT environment variable"
+	}
+
+	if value := os.Getenv("TLS_CERT_FILE"); value != "" {
+		c.TLSCertFile = value
+	}
+	if value := os.Getenv("TLS_KEY_FILE"); value != "" {
+		c.TLSKeyFile = value
+	}
+
+	/*
+		CORS_ORIGINS is a comma-separated list of origins that browsers may call
+		the API from, e.g. "http://localhost:3000,https://example.com".
+		ALLOWED_ORIGINS is the older name for the same setting and is still read
+		when CORS_ORIGINS isn't set.
+	*/
+	origins := os.Getenv("CORS_ORIGINS")
+	if origins == "" {
+		origins = os.Getenv("ALLOWED_ORIGINS")
+	}
+	if origins != "" {
+		c.CORSOrigins = splitOrigins(origins)
+	}
+
+	/*
+		RATE_LIMIT_RPS is how many requests per second a client may make on
+		average, and RATE_LIMIT_BURST is how many it may make at once.
+	*/
+	if value := os.Getenv("RATE_LIMIT_RPS"); value != "" {
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil || rps <= 0 {
+			return fmt.Errorf("invalid RATE_LIMIT_RPS %q: must be a number above 0", value)
+		}
+		c.RateLimitRPS = rps
+	}
+
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return fmt.Errorf("invalid RATE_LIMIT_BURST %q: must be a whole number above 0", value)
+		}
+		c.RateLimitBurst = burst
+	}
+
+	// MAX_BODY_BYTES sets the largest request body in bytes the server accepts
+	if value := os.Getenv("MAX_BODY_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid MAX_BODY_BYTES %q: must be a whole number above 0", value)
+		}
+		c.MaxBodyBytes = n
+	}
+
+	// MAX_PRINT_BYTES sets the longest text in bytes that /print sends back
+	if value := os.Getenv("MAX_PRINT_BYTES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid MAX_PRINT_BYTES %q: must be a whole number above 0", value)
+		}
+		c.MaxPrintBytes = n
+	}
+
+	/*
+		MAX_UPLOAD_BYTES sets the largest file in bytes POST /upload stores. The
+		whole request still has to fit in MAX_BODY_BYTES.
+	*/
+	if value := os.Getenv("MAX_UPLOAD_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid MAX_UPLOAD_BYTES %q: must be a whole number above 0", value)
+		}
+		c.MaxUploadBytes = n
+	}
+
+	// UPLOAD_DIR is the directory POST /upload stores files in
+	if value := os.Getenv("UPLOAD_DIR"); value != "" {
+		c.UploadDir = value
+	}
+
+	// STATIC_DIR is the directory with the files served under /static/
+	if value := os.Getenv("STATIC_DIR"); value != "" {
+		c.StaticDir = value
+	}
+
+	// DB_PATH is the SQLite database file for the todos, without it they are kept in memory
+	if value := os.Getenv("DB_PATH"); value != "" {
+		c.DBPath = value
+	}
+
+	// UPSTREAM_URL is the server /proxy/ forwards requests to, without it there is no /proxy/
+	if value := os.Getenv("UPSTREAM_URL"); value != "" {
+		c.UpstreamURL = value
+	}
+
+	/*
+		ENABLE_PPROF=true turns on the profiling endpoints under /debug/pprof/.
+		strconv.ParseBool also understands values like 1, 0, TRUE and false.
+	*/
+	if value := os.Getenv("ENABLE_PPROF"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ENABLE_PPROF %q: must be true or false", value)
+		}
+		c.EnablePprof = enabled
+	}
+
+	// CONTENT_SECURITY_POLICY replaces the Content-Security-Policy header sent with every response
+	if value := os.Getenv("CONTENT_SECURITY_POLICY"); value != "" {
+		c.ContentSecurityPolicy = value
+	}
+
+	// LOG_BODIES=true logs the start of every request body, see bodyLoggingMiddleware
+	if value := os.Getenv("LOG_BODIES"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_BODIES %q: must be true or false", value)
+		}
+		c.LogBodies = enabled
+	}
+
+	/*
+		TRUST_PROXY=true uses the client address from the X-Forwarded-For or
+		X-Real-IP header, see resolveClientIP. Only set it when the server is
+		behind a proxy that sets these headers, otherwise clients can choose
+		their own address.
+	*/
+	if value := os.Getenv("TRUST_PROXY"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid TRUST_PROXY %q: must be true or false", value)
+		}
+		c.TrustProxy = enabled
+	}
+
+	// PROBLEM_JSON=true sends errors as application/problem+json, see problem.go
+	if value := os.Getenv("PROBLEM_JSON"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid PROBLEM_JSON %q: must be true or false", value)
+		}
+		c.ProblemJSON = enabled
+	}
+
+	/*
+		REQUEST_TIMEOUT is how long a handler may take. READ_TIMEOUT is how long
+		a client may take to send its request and READ_HEADER_TIMEOUT how long
+		for only the headers, WRITE_TIMEOUT how long sending the response may
+		take and IDLE_TIMEOUT how long a kept-alive connection may wait for the
+		next request.
+	*/
+	var err error
+	if c.RequestTimeout.Duration, err = durationFromEnv("REQUEST_TIMEOUT", c.RequestTimeout.Duration); err != nil {
+		return err
+	}
+	if c.ReadTimeout.Duration, err = durationFromEnv("READ_TIMEOUT", c.ReadTimeout.Duration); err != nil {
+		return err
+	}
+	if c.ReadHeaderTimeout.Duration, err = durationFromEnv("READ_HEADER_TIMEOUT", c.ReadHeaderTimeout.Duration); err != nil {
+		return err
+	}
+	if c.WriteTimeout.Duration, err = durationFromEnv("WRITE_TIMEOUT", c.WriteTimeout.Duration); err != nil {
+		return err
+	}
+	if c.IdleTimeout.Duration, err = durationFromEnv("IDLE_TIMEOUT", c.IdleTimeout.Duration); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Config) applyFlags(f flags) error {
+	/*
+		The flags win over everything else, so whoever starts the program can
+		always override what the environment and the config file say. -addr
+		wins over -port when both are given.
+	*/
+	if f.port != "" {
+		port, err := parsePort("-port", f.port)
+		if err != nil {
+			return err
+		}
+		c.Port, c.Addr, c.addrSource = port, "", "-port flag"
+	}
+
+	if f.addr != "" {
+		// net.SplitHostPort checks that the address looks like host:port
+		if _, _, err := net.SplitHostPort(f.addr); err != nil {
+			return fmt.Errorf("invalid -addr %q: must be in the form host:port", f.addr)
+		}
+		c.Addr, c.addrSource = f.addr, "-addr flag"
+	}
+
+	if f.tlsCert != "" {
+		c.TLSCertFile = f.tlsCert
+	}
+	if f.tlsKey != "" {
+		c.TLSKeyFile = f.tlsKey
+	}
+	if f.staticDir != "" {
+		c.StaticDir = f.staticDir
+	}
+
+	// -pprof can only turn profiling on, leaving it out keeps the other settings
+	if f.pprof {
+		c.EnablePprof = true
+	}
+	return nil
+}
+
+// listenAddr returns the address to listen on. Without an addr the server
+// listens on all interfaces using the port.
+func (c *Config) listenAddr() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	return ":" + strconv.Itoa(c.Port)
+}
+
+func parsePort(name, value string) (int, error) {
+	/*
+		strconv.Atoi converts a string to an int and returns an error if the
+		string isn't a number. A valid TCP port is between 1 and 65535.
+	*/
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s %q: must be a number between 1 and 65535", name, value)
+	}
+	return port, nil
+}
+
+// displayAddr turns a listen address like ":5000" into something that can be
+// opened in a browser, like "localhost:5000".
+func displayAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// splitOrigins splits a comma-separated list of origins, skipping empty ones.
+func splitOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	// time.ParseDuration understands durations like "15s", "500ms" or "1m"
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a duration above 0 like 15s", name, value)
+	}
+	return d, nil
+}
+
+func resolveBasicAuth() (username string, password string, err error) {
+	/*
+		ADMIN_USER and ADMIN_PASS are the username and password needed for the
+		/admin endpoints. Like for TLS, only one of them is a mistake.
+	*/
+	username, password = os.Getenv("ADMIN_USER"), os.Getenv("ADMIN_PASS")
+	if (username == "") != (password == "") {
+		return "", "", fmt.Errorf("both ADMIN_USER and ADMIN_PASS are needed for the /admin endpoints")
+	}
+	if username != "" {
+		return username, password, nil
+	}
+
+	// BASIC_AUTH_USER and BASIC_AUTH_PASS are the older names, which still work
+	username, password = os.Getenv("BASIC_AUTH_USER"), os.Getenv("BASIC_AUTH_PASS")
+	if (username == "") != (password == "") {
+		return "", "", fmt.Errorf("both BASIC_AUTH_USER and BASIC_AUTH_PASS are needed for the /admin endpoints")
+	}
+	return username, password, nil
+}
+
+func resolveLoginCredentials() (username string, password string, err error) {
+	/*
+		LOGIN_USER and LOGIN_PASS are the only username and password POST /login
+		gives a token for. There is no default user, so nobody can log in with a
+		password from the README on a server that forgot to set them.
+	*/
+	username, password = os.Getenv("LOGIN_USER"), os.Getenv("LOGIN_PASS")
+	if (username == "") != (password == "") {
+		return "", "", fmt.Errorf("both LOGIN_USER and LOGIN_PASS are needed for POST /login")
+	}
+	return username, password, nil
+}
+
+func resolveJWTSecret() []byte {
+	/*
+		JWT_SECRET is the key used to check the signature of the tokens sent to
+		protected endpoints. Anyone who knows it can make valid tokens, so it
+		should be long, random and never committed to git.
+	*/
+	return []byte(os.Getenv("JWT_SECRET"))
+}
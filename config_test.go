@@ -0,0 +1,237 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPortFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset", port: "", want: ":5000"},
+		{name: "valid", port: "8080", want: ":8080"},
+		{name: "lowest", port: "1", want: ":1"},
+		{name: "highest", port: "65535", want: ":65535"},
+		{name: "zero", port: "0", wantErr: true},
+		{name: "out of range", port: "65536", wantErr: true},
+		{name: "not a number", port: "eighty", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// An empty value counts as not set, so this also covers the unset case
+			t.Setenv("PORT", tt.port)
+
+			cfg, err := resolveConfig(flags{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PORT=%q gave no error, want one", tt.port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PORT=%q gave error: %v", tt.port, err)
+			}
+			if got := cfg.listenAddr(); got != tt.want {
+				t.Errorf("PORT=%q listens on %q, want %q", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddrFlag(t *testing.T) {
+	t.Setenv("PORT", "")
+
+	cfg, err := resolveConfig(flags{addr: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.listenAddr(); got != "127.0.0.1:8080" {
+		t.Errorf("-addr 127.0.0.1:8080 listens on %q", got)
+	}
+	if cfg.addrSource != "-addr flag" {
+		t.Errorf("addrSource = %q, want -addr flag", cfg.addrSource)
+	}
+
+	// The flag wins over the environment too
+	t.Setenv("PORT", "9000")
+	cfg, err = resolveConfig(flags{addr: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.listenAddr(); got != "127.0.0.1:8080" {
+		t.Errorf("-addr with PORT=9000 listens on %q, want the flag", got)
+	}
+
+	if _, err := resolveConfig(flags{addr: "8080"}); err == nil {
+		t.Error("-addr without a host:port gave no error")
+	}
+}
+
+func TestPortEnvironmentVariable(t *testing.T) {
+	t.Setenv("PORT", "6000")
+
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 6000 || cfg.listenAddr() != ":6000" {
+		t.Errorf("PORT=6000 gave port %d and address %q", cfg.Port, cfg.listenAddr())
+	}
+	if cfg.addrSource != "PORT environment variable" {
+		t.Errorf("addrSource = %q, want PORT environment variable", cfg.addrSource)
+	}
+}
+
+func TestPortFlag(t *testing.T) {
+	t.Setenv("PORT", "6000")
+
+	// -port wins over PORT, and -addr wins over -port
+	cfg, err := resolveConfig(flags{port: "7000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.listenAddr() != ":7000" || cfg.addrSource != "-port flag" {
+		t.Errorf("-port 7000 with PORT=6000 gave %q from %s", cfg.listenAddr(), cfg.addrSource)
+	}
+
+	cfg, err = resolveConfig(flags{port: "7000", addr: "127.0.0.1:8000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.listenAddr() != "127.0.0.1:8000" {
+		t.Errorf("-port 7000 -addr 127.0.0.1:8000 listens on %q, want the -addr", cfg.listenAddr())
+	}
+
+	if _, err := resolveConfig(flags{port: "70000"}); err == nil {
+		t.Error("-port 70000 gave no error")
+	}
+}
+
+func TestTrustProxyFromEnvironment(t *testing.T) {
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TrustProxy {
+		t.Error("TrustProxy is on by default, want off")
+	}
+
+	t.Setenv("TRUST_PROXY", "true")
+	if cfg, err = resolveConfig(flags{}); err != nil || !cfg.TrustProxy {
+		t.Errorf("TRUST_PROXY=true gave TrustProxy %v, %v", cfg != nil && cfg.TrustProxy, err)
+	}
+
+	t.Setenv("TRUST_PROXY", "sometimes")
+	if _, err := resolveConfig(flags{}); err == nil {
+		t.Error("TRUST_PROXY=sometimes gave no error")
+	}
+}
+
+func TestTLSFiles(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "env-cert.pem")
+	t.Setenv("TLS_KEY_FILE", "env-key.pem")
+
+	cfg, err := resolveConfig(flags{tlsCert: "flag-cert.pem", tlsKey: "flag-key.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLSCertFile != "flag-cert.pem" || cfg.TLSKeyFile != "flag-key.pem" {
+		t.Errorf("got certificate %q and key %q, want the flags to win", cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+
+	// A certificate without a key is a mistake
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := resolveConfig(flags{}); err == nil {
+		t.Error("a certificate without a key gave no error")
+	}
+}
+
+// writeConfigFile writes content to a file called name in a temporary
+// directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigExample(t *testing.T) {
+	cfg, err := loadConfig("config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The example file lists the defaults
+	if def := defaultConfig(); cfg.Port != def.Port || cfg.RequestTimeout != def.RequestTimeout || cfg.MaxBodyBytes != def.MaxBodyBytes {
+		t.Errorf("the example gave port %d, timeout %v and body limit %d, want the defaults", cfg.Port, cfg.RequestTimeout, cfg.MaxBodyBytes)
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"port": 7000, "request_timeout": "3s", "cors_origins": ["https://example.com"]}`,
+		"config.yaml": "port: 7000\nrequest_timeout: 3s\ncors_origins:\n  - https://example.com\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := loadConfig(writeConfigFile(t, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Port != 7000 || cfg.RequestTimeout.Duration != 3*time.Second || len(cfg.CORSOrigins) != 1 || cfg.addrSource != "config file" {
+				t.Errorf("got %+v", cfg)
+			}
+
+			// Settings that aren't in the file keep their default
+			if cfg.RateLimitBurst != defaultConfig().RateLimitBurst {
+				t.Errorf("RateLimitBurst = %d, want the default", cfg.RateLimitBurst)
+			}
+		})
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "port: 7000\nrate_limit_burst: 3\nmax_print_bytes: 10\n")
+	t.Setenv("PORT", "8000")
+	t.Setenv("RATE_LIMIT_BURST", "4")
+
+	cfg, err := resolveConfig(flags{config: path, port: "9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flags win over the environment, which wins over the file, which wins over the defaults
+	if cfg.Port != 9000 || cfg.RateLimitBurst != 4 || cfg.MaxPrintBytes != 10 || cfg.MaxBodyBytes != defaultMaxBodyBytes {
+		t.Errorf("got port %d, burst %d, print limit %d and body limit %d", cfg.Port, cfg.RateLimitBurst, cfg.MaxPrintBytes, cfg.MaxBodyBytes)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "config.json", content: `{"prot": 7000}`},
+		{name: "config.yaml", content: "prot: 7000\n"},
+		{name: "config.yaml", content: "request_timeout: soon\n"},
+		{name: "config.yaml", content: "max_body_bytes: 0\n"},
+		{name: "config.toml", content: "port = 7000\n"},
+	}
+	for _, tt := range tests {
+		if _, err := loadConfig(writeConfigFile(t, tt.name, tt.content)); err == nil {
+			t.Errorf("%s with %q gave no error", tt.name, tt.content)
+		}
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing file gave no error")
+	}
+}
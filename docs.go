@@ -0,0 +1,39 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// swaggerUI holds the files of the swagger-ui directory. Like the landing
+// page they are embedded in the program, so /docs works without the files
+// next to it and without loading anything from the internet.
+//
+//go:embed swagger-ui/index.html swagger-ui/swagger-initializer.js swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var swaggerUI embed.FS
+
+func apiDocs() http.Handler {
+	/*
+		fs.Sub gives the files as if swagger-ui was the root, so the file server
+		finds swagger-ui/swagger-ui.css as /swagger-ui.css. The errors can only
+		happen if the files weren't embedded, which the compiler already checks.
+	*/
+	files, _ := fs.Sub(swaggerUI, "swagger-ui")
+	index, _ := fs.ReadFile(files, "index.html")
+	fileServer := http.StripPrefix("/docs", http.FileServer(http.FS(files)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/*
+			/docs itself shows the page, and anything under /docs/ is one of the
+			files it loads. The file server would redirect /docs to /docs/, so the
+			page is written here instead.
+		*/
+		if r.URL.Path == "/docs" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
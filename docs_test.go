@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDocsPage(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serveRequest(router, "GET", "/docs", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /docs = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("GET /docs has Content-Type %q, want text/html", got)
+	}
+
+	// Every file the page loads is served by the program itself
+	page := rec.Body.String()
+	for _, file := range []string{"/docs/swagger-ui.css", "/docs/swagger-ui-bundle.js", "/docs/swagger-initializer.js"} {
+		if !strings.Contains(page, file) {
+			t.Errorf("the page doesn't load %s", file)
+			continue
+		}
+		if rec := serveRequest(router, "GET", file, ""); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("GET %s = %d with %d bytes, want the embedded file", file, rec.Code, rec.Body.Len())
+		}
+	}
+	if strings.Contains(page, "https://") {
+		t.Error("the page loads something from the internet")
+	}
+
+	// The page shows the spec of this server
+	rec = serveRequest(router, "GET", "/docs/swagger-initializer.js", "")
+	if !strings.Contains(rec.Body.String(), `url: "/openapi.json"`) {
+		t.Errorf("swagger-initializer.js doesn't point at /openapi.json:\n%s", rec.Body)
+	}
+}
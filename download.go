@@ -0,0 +1,53 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func download(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		/*
+			The name may only be a file name, never a path, otherwise a name like
+			../config.go could read any file the server can. A / never gets here
+			because {name} doesn't match it, but a \ is a separator on Windows.
+		*/
+		name := mux.Vars(r)["name"]
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_name", "the name must be a file name without a path")
+			return
+		}
+
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			writeAPIError(w, r, http.StatusNotFound, "file_not_found", "file not found")
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			writeAPIError(w, r, http.StatusNotFound, "file_not_found", "file not found")
+			return
+		}
+
+		/*
+			Content-Disposition: attachment makes browsers save the file instead
+			of showing it, under the given filename. mime.FormatMediaType puts
+			the name in quotes and escapes it where needed.
+		*/
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+		/*
+			http.ServeContent sets the Content-Type from the extension of the name
+			and answers Range requests, so a large download can be continued where
+			it stopped. It also handles If-Modified-Since with the modification time.
+		*/
+		http.ServeContent(w, r, name, info.ModTime(), file)
+	}
+}
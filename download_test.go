@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	shared := testServices(t)
+	router := newV1Router(t, shared)
+	if err := os.WriteFile(filepath.Join(shared.uploadDir, "yoda.txt"), []byte("Do or do not"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveRequest(router, "GET", "/download/yoda.txt", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "Do or do not" {
+		t.Fatalf("GET /download/yoda.txt = %d %q, want 200 with the file", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=yoda.txt` {
+		t.Errorf("Content-Disposition is %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type is %q, want text/plain; charset=utf-8", got)
+	}
+
+	// A range asks for part of the file
+	req := httptest.NewRequest("GET", "/download/yoda.txt", nil)
+	req.Header.Set("Range", "bytes=6-")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "do not" {
+		t.Errorf("GET with Range: bytes=6- = %d %q, want 206 \"do not\"", rec.Code, rec.Body)
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	shared := testServices(t)
+	router := newV1Router(t, shared)
+	if err := os.Mkdir(filepath.Join(shared.uploadDir, "folder"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "missing", target: "/download/nope.txt", wantCode: http.StatusNotFound, wantErr: "file_not_found"},
+		{name: "directory", target: "/download/folder", wantCode: http.StatusNotFound, wantErr: "file_not_found"},
+		{name: "backslash", target: `/download/..%5Cmain.go`, wantCode: http.StatusBadRequest, wantErr: "invalid_name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, "GET", tt.target, "")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s = %d, want %d\n%s", tt.target, rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := decodeError(t, rec).Code; got != tt.wantErr {
+				t.Errorf("error code = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
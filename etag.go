@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagWriter holds back the response of a handler, so withETag can compute
+// the ETag from the whole body before anything is sent.
+type etagWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.status == 0 {
+		ew.status = status
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.status = http.StatusOK
+	}
+	return ew.buf.Write(b)
+}
+
+// withETag lets a read handler answer conditional requests. The ETag is a
+// fingerprint of the response body, and a client that already has the body
+// sends it back in If-None-Match. If the body is still the same, it gets
+// 304 Not Modified without a body and can keep using what it has.
+func withETag(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ew := &etagWriter{ResponseWriter: w}
+		h(ew, r)
+		if ew.status == 0 {
+			ew.status = http.StatusOK
+		}
+
+		// Only successful responses are worth caching, the rest are sent as they are
+		if ew.status != http.StatusOK {
+			w.WriteHeader(ew.status)
+			w.Write(ew.buf.Bytes())
+			return
+		}
+
+		/*
+			The first 16 bytes of the SHA-256 hash are plenty to tell two bodies
+			apart. An ETag is always written in double quotes, and the W/ marks it
+			as weak: it promises the same content, not the same bytes, which is
+			true because gzipMiddleware may still compress the body.
+		*/
+		sum := sha256.Sum256(ew.buf.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(ew.buf.Bytes())
+	}
+}
+
+// etagMatches reports whether the If-None-Match header value contains etag.
+// The header can list several ETags separated by commas, or be "*" to match
+// any. If-None-Match uses the weak comparison, where the W/ in front of an
+// ETag doesn't matter.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// getWithETag sends a GET request to h, with If-None-Match set unless it is
+// empty.
+func getWithETag(h http.Handler, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWithETag(t *testing.T) {
+	body := "the same every time"
+	h := withETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	first := getWithETag(h, "/", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Body.String() != body || etag == "" {
+		t.Fatalf("first request = %d %q with ETag %q, want 200 with an ETag", first.Code, first.Body, etag)
+	}
+
+	second := getWithETag(h, "/", etag)
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 || second.Header().Get("ETag") != etag {
+		t.Errorf("conditional request = %d with %d bytes, want 304 without a body", second.Code, second.Body.Len())
+	}
+
+	// A changed body gets a new ETag, so the old one doesn't match anymore
+	body = "something else"
+	third := getWithETag(h, "/", etag)
+	if third.Code != http.StatusOK || third.Header().Get("ETag") == etag {
+		t.Errorf("after a change = %d with ETag %q, want 200 with a new ETag", third.Code, third.Header().Get("ETag"))
+	}
+}
+
+func TestWithETagSkipsErrors(t *testing.T) {
+	h := withETag(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "not_found", "not found")
+	})
+	rec := getWithETag(h, "/", "*")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Errorf("an error = %d with ETag %q, want 404 without one", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{ifNoneMatch: `W/"abc"`, want: true},
+		{ifNoneMatch: `"abc"`, want: true},
+		{ifNoneMatch: `"xyz", W/"abc"`, want: true},
+		{ifNoneMatch: `*`, want: true},
+		{ifNoneMatch: `"xyz"`, want: false},
+		{ifNoneMatch: ``, want: false},
+		{ifNoneMatch: `abc`, want: false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, `W/"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
+
+func TestETagOnRoutes(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+	serveRequest(router, "POST", "/kv", `{"key": "name", "value": "Yoda"}`)
+	serveRequest(router, "POST", "/notes", `{"body": "Do or do not"}`)
+	serveRequest(router, "POST", "/todos", `{"title": "Lift the X-wing"}`)
+
+	for _, target := range []string{"/kv/name", "/notes", "/notes/1", "/todos", "/todos/1"} {
+		first := getWithETag(router, target, "")
+		etag := first.Header().Get("ETag")
+		if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+			t.Errorf("GET %s = %d with ETag %q, want 200 with a weak ETag", target, first.Code, etag)
+			continue
+		}
+		second := getWithETag(router, target, etag)
+		if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+			t.Errorf("GET %s with If-None-Match = %d with %d bytes, want 304 without a body", target, second.Code, second.Body.Len())
+		}
+	}
+
+	// The memory numbers of /system change all the time, so * is used to match any ETag
+	first := getWithETag(router, "/system", "")
+	if first.Code != http.StatusOK || first.Header().Get("ETag") == "" {
+		t.Fatalf("GET /system = %d with ETag %q, want 200 with an ETag", first.Code, first.Header().Get("ETag"))
+	}
+	second := getWithETag(router, "/system", "*")
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Errorf("GET /system with If-None-Match: * = %d with %d bytes, want 304 without a body", second.Code, second.Body.Len())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func systemStream(w http.ResponseWriter, r *http.Request) {
+	// Every event is the same JSON object as /system responds with
+	streamEvents(w, r, func() interface{} { return systemInfo() })
+}
+
+func timeStream(w http.ResponseWriter, r *http.Request) {
+	streamEvents(w, r, func() interface{} {
+		now := time.Now().UTC()
+		return map[string]interface{}{
+			"time": now.Format(time.RFC3339),
+			"unix": now.Unix(),
+		}
+	})
+}
+
+// streamEvents sends the value returned by event to the client as a
+// Server-Sent Event every second, until the client disconnects or the
+// server shuts down.
+func streamEvents(w http.ResponseWriter, r *http.Request, event func() interface{}) {
+	/*
+		Server-Sent Events keep the response open and send a new event whenever
+		there is one. Each event has to be flushed, otherwise it waits in a
+		buffer until the response is done, which for a stream is never.
+	*/
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, r, http.StatusInternalServerError, "streaming_not_supported", "streaming is not supported")
+		return
+	}
+
+	/*
+		The server's WriteTimeout and ReadTimeout would end the stream after a
+		few seconds. http.ResponseController lets a single handler turn them off
+		for its own connection; a zero time means no deadline.
+	*/
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+	controller.SetReadDeadline(time.Time{})
+
+	// text/event-stream is the format of Server-Sent Events, and it must never be cached
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Proxies like nginx buffer responses by default, which holds back the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		// Every event is a line starting with "data: ", followed by an empty line
+		data, err := json.Marshal(event())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		/*
+			The request context is cancelled when the client disconnects, so the
+			loop stops instead of writing to nobody forever.
+		*/
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
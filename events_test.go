@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openStream starts a server for h and opens an event stream on it. The
+// stream is closed when ctx is cancelled.
+func openStream(t *testing.T, ctx context.Context, h http.HandlerFunc) (*http.Response, *bufio.Scanner) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewScanner(resp.Body)
+}
+
+// nextEvent returns the data of the next event on the stream.
+func nextEvent(t *testing.T, events *bufio.Scanner) string {
+	t.Helper()
+	for events.Scan() {
+		if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+			return data
+		}
+	}
+	t.Fatalf("the stream ended without an event: %v", events.Err())
+	return ""
+}
+
+func TestSystemStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, events := openStream(t, ctx, systemStream)
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+
+	// The first event comes right away and the next one a second later
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		var info SystemInfo
+		if err := json.Unmarshal([]byte(nextEvent(t, events)), &info); err != nil {
+			t.Fatalf("event %d is not the system info: %v", i+1, err)
+		}
+		if info.GoVersion == "" || info.NumCPU < 1 {
+			t.Errorf("event %d has %+v", i+1, info)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("two events took %v, want about a second", elapsed)
+	}
+
+	// After the client goes away the stream ends
+	cancel()
+	for events.Scan() {
+	}
+	if events.Err() == nil {
+		t.Error("the stream didn't end after cancelling")
+	}
+}
+
+func TestTimeStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, events := openStream(t, ctx, timeStream)
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	var previous int64
+	for i := 0; i < 2; i++ {
+		var event struct {
+			Time string `json:"time"`
+			Unix int64  `json:"unix"`
+		}
+		if err := json.Unmarshal([]byte(nextEvent(t, events)), &event); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := time.Parse(time.RFC3339, event.Time)
+		if err != nil || parsed.Unix() != event.Unix || event.Unix < previous {
+			t.Errorf("event %d has time %s and unix %d", i+1, event.Time, event.Unix)
+		}
+		previous = event.Unix
+	}
+	cancel()
+}
+
+func TestStreamEndsOnShutdown(t *testing.T) {
+	shuttingDown = make(chan struct{})
+	t.Cleanup(func() { shuttingDown = make(chan struct{}) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, events := openStream(t, ctx, timeStream)
+	nextEvent(t, events)
+
+	// The server closes the stream itself, so the client reads to the end without an error
+	close(shuttingDown)
+	for events.Scan() {
+	}
+	if err := events.Err(); err != nil {
+		t.Errorf("the stream ended with %v, want a normal end", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the stream only ended because of the timeout")
+	}
+}
+
+// noFlushWriter hides the Flush method of the ResponseWriter it wraps.
+type noFlushWriter struct {
+	http.ResponseWriter
+}
+
+func TestStreamWithoutFlusher(t *testing.T) {
+	rec := httptest.NewRecorder()
+	timeStream(noFlushWriter{rec}, httptest.NewRequest("GET", "/events/time", nil))
+	if rec.Code != http.StatusInternalServerError || decodeError(t, rec).Code != "streaming_not_supported" {
+		t.Errorf("got %d %s, want 500 streaming_not_supported", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// hashFuncs maps the algorithm names accepted by /hash/{algo} to a function
+// creating a new hash of that kind. Adding an algorithm only takes a new line.
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+func getHash(w http.ResponseWriter, r *http.Request) {
+	/*
+		This endpoint uses both kinds of parameters: the algorithm is a dynamic
+		url parameter from the path, and the text to hash is a query parameter,
+		e.g. /hash/sha256?input=hello.
+	*/
+	algorithm := mux.Vars(r)["algo"]
+	newHash, ok := hashFuncs[algorithm]
+	if !ok {
+		writeAPIError(w, r, http.StatusBadRequest, "unsupported_algorithm", "unsupported algorithm, use md5, sha1 or sha256")
+		return
+	}
+
+	/*
+		Get returns "" both when input is missing and when it is empty, so Has is
+		used to tell them apart. Hashing an empty text is fine.
+	*/
+	query := r.URL.Query()
+	if !query.Has("input") {
+		writeAPIError(w, r, http.StatusBadRequest, "missing_input", "input is required")
+		return
+	}
+	input := query.Get("input")
+
+	// A hash is a list of bytes, which hex.EncodeToString turns into readable text
+	h := newHash()
+	h.Write([]byte(input))
+
+	writeSuccess(w, r, http.StatusOK, map[string]string{
+		"algorithm": algorithm,
+		"input":     input,
+		"hash":      hex.EncodeToString(h.Sum(nil)),
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	// The hashes of "hello", e.g. from echo -n hello | sha256sum
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{algorithm: "md5", want: "5d41402abc4b2a76b9719d911017c592"},
+		{algorithm: "sha1", want: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{algorithm: "sha256", want: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			rec := serveRequest(router, "GET", "/hash/"+tt.algorithm+"?input=hello", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /hash/%s = %d, want 200", tt.algorithm, rec.Code)
+			}
+			var data map[string]string
+			decodeData(t, rec, &data)
+			if data["algorithm"] != tt.algorithm || data["input"] != "hello" || data["hash"] != tt.want {
+				t.Errorf("got %v, want the %s hash %s", data, tt.algorithm, tt.want)
+			}
+		})
+	}
+
+	// An empty input is allowed, it only has to be there
+	rec := serveRequest(router, "GET", "/hash/md5?input=", "")
+	var data map[string]string
+	decodeData(t, rec, &data)
+	if data["hash"] != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf("the md5 of an empty input is %q", data["hash"])
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		target   string
+		wantCode string
+	}{
+		{target: "/hash/sha512?input=hello", wantCode: "unsupported_algorithm"},
+		{target: "/hash/SHA256?input=hello", wantCode: "unsupported_algorithm"},
+		{target: "/hash/sha256", wantCode: "missing_input"},
+	}
+	for _, tt := range tests {
+		rec := serveRequest(router, "GET", tt.target, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != tt.wantCode {
+			t.Errorf("GET %s = %d %s, want 400 %s", tt.target, rec.Code, rec.Body, tt.wantCode)
+		}
+	}
+}
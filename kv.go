@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// store is a simple in-memory key-value store. Handlers run concurrently, one
+// goroutine per request, so the map is guarded by a sync.RWMutex: many
+// requests can read at the same time, but writing needs exclusive access.
+// The data is lost when the program stops.
+type store struct {
+	mu   sync.RWMutex
+	data map[string]string
+}
+
+func newStore() *store {
+	return &store{data: map[string]string{}}
+}
+
+// len returns the number of entries in the store.
+func (s *store) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// kvPair is the JSON shape used to send an entry of the store to the client.
+type kvPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// kvCreateInput and kvUpdateInput are the bodies of POST /kv and PUT
+// /kv/{key}. The rules they have to follow are written in the validate tags,
+// which decodeAndValidate checks.
+type kvCreateInput struct {
+	Key   string `json:"key" validate:"required,max=256"`
+	Value string `json:"value" validate:"max=4096"`
+}
+
+type kvUpdateInput struct {
+	Value string `json:"value" validate:"max=4096"`
+}
+
+func (s *store) create(w http.ResponseWriter, r *http.Request) {
+	var input kvCreateInput
+	if err := decodeAndValidate(r, &input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	pair := kvPair{Key: input.Key, Value: input.Value}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Creating a key that already exists is a conflict, use PUT to change it
+	if _, exists := s.data[pair.Key]; exists {
+		writeError(w, r, http.StatusConflict, "key_exists", "key already exists")
+		return
+	}
+	s.data[pair.Key] = pair.Value
+
+	writeSuccess(w, r, http.StatusCreated, pair)
+}
+
+func (s *store) get(w http.ResponseWriter, r *http.Request) {
+	// The key comes from the url path, just like in the print function
+	key := mux.Vars(r)["key"]
+
+	s.mu.RLock()
+	value, exists := s.data[key]
+	s.mu.RUnlock()
+
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "key_not_found", "key not found")
+		return
+	}
+	writeSuccess(w, r, http.StatusOK, kvPair{Key: key, Value: value})
+}
+
+func (s *store) update(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	// Only the value is read from the body, the key is always the one in the path
+	var input kvUpdateInput
+	if err := decodeAndValidate(r, &input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data[key]; !exists {
+		writeAPIError(w, r, http.StatusNotFound, "key_not_found", "key not found")
+		return
+	}
+	s.data[key] = input.Value
+
+	writeSuccess(w, r, http.StatusOK, kvPair{Key: key, Value: input.Value})
+}
+
+func (s *store) delete(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data[key]; !exists {
+		writeAPIError(w, r, http.StatusNotFound, "key_not_found", "key not found")
+		return
+	}
+	delete(s.data, key)
+
+	// 204 No Content means it worked, but there's nothing to send back
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestKVStore(t *testing.T) {
+	// The steps run in order on the same store, so each one sees what the steps before did
+	router := newV1Router(t, testServices(t))
+	steps := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantErr  string
+		want     *kvPair
+	}{
+		{name: "create", method: "POST", target: "/kv", body: `{"key": "name", "value": "Yoda"}`, wantCode: http.StatusCreated, want: &kvPair{"name", "Yoda"}},
+		{name: "create existing", method: "POST", target: "/kv", body: `{"key": "name", "value": "Luke"}`, wantCode: http.StatusConflict, wantErr: "key_exists"},
+		{name: "create without key", method: "POST", target: "/kv", body: `{"value": "Luke"}`, wantCode: http.StatusBadRequest, wantErr: "validation_failed"},
+		{name: "create invalid JSON", method: "POST", target: "/kv", body: `{"key":`, wantCode: http.StatusBadRequest, wantErr: "invalid_json"},
+		{name: "read", method: "GET", target: "/kv/name", wantCode: http.StatusOK, want: &kvPair{"name", "Yoda"}},
+		{name: "read missing", method: "GET", target: "/kv/nope", wantCode: http.StatusNotFound, wantErr: "key_not_found"},
+		{name: "update", method: "PUT", target: "/kv/name", body: `{"value": "Master Yoda"}`, wantCode: http.StatusOK, want: &kvPair{"name", "Master Yoda"}},
+		{name: "read updated", method: "GET", target: "/kv/name", wantCode: http.StatusOK, want: &kvPair{"name", "Master Yoda"}},
+		{name: "update missing", method: "PUT", target: "/kv/nope", body: `{"value": "x"}`, wantCode: http.StatusNotFound, wantErr: "key_not_found"},
+		{name: "delete", method: "DELETE", target: "/kv/name", wantCode: http.StatusNoContent},
+		{name: "read deleted", method: "GET", target: "/kv/name", wantCode: http.StatusNotFound, wantErr: "key_not_found"},
+		{name: "delete missing", method: "DELETE", target: "/kv/name", wantCode: http.StatusNotFound, wantErr: "key_not_found"},
+	}
+	for _, step := range steps {
+		rec := serveRequest(router, step.method, step.target, step.body)
+		if rec.Code != step.wantCode {
+			t.Fatalf("%s: %s %s = %d, want %d\n%s", step.name, step.method, step.target, rec.Code, step.wantCode, rec.Body)
+		}
+		if step.wantErr != "" {
+			if got := decodeError(t, rec).Code; got != step.wantErr {
+				t.Errorf("%s: error code = %q, want %q", step.name, got, step.wantErr)
+			}
+		}
+		if step.want != nil {
+			var got kvPair
+			decodeData(t, rec, &got)
+			if got != *step.want {
+				t.Errorf("%s: got %+v, want %+v", step.name, got, *step.want)
+			}
+		}
+	}
+}
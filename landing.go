@@ -0,0 +1,118 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// The //go:embed line puts the file inside the program when it's compiled,
+// so the landing page works no matter which directory the server runs in.
+//
+//go:embed templates/index.html
+var indexHTML string
+
+// html/template escapes everything it puts into the page, so a path with
+// e.g. < in it can't break the HTML.
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// routeDescriptions has a short description of what an endpoint does, shown
+// next to it on the landing page. A path missing here is still listed, just
+// without a description. The API paths are written without /v1.
+var routeDescriptions = map[string]string{
+	"/hello":                   "Says hello back (GET), or shows the JSON you sent (POST)",
+	"/print/{what_to_print}":   "Prints the text in the path",
+	"/transform/{mode}/{text}": "The text in the path in upper or lower case",
+	"/reverse/{text}":          "The text in the path backwards",
+	"/system":                  "Information about the system the server runs on",
+	"/system/stream":           "The /system information every second as Server-Sent Events",
+	"/events/time":             "The current time every second as Server-Sent Events",
+	"/request-info/{params}":   "Information about the request you sent",
+	"/echo":                    "Information about the request you sent, including its body",
+	"/echo/raw":                "The body you sent, exactly as it was sent",
+	"/ws/echo":                 "A WebSocket that sends every message back",
+	"/whoami":                  "Your IP address, as the server sees it",
+	"/uuid":                    "One or more random UUIDs",
+	"/random":                  "One or more random numbers in a range of your choice",
+	"/time":                    "The current time, in a timezone of your choice",
+	"/hash/{algo}":             "The md5, sha1 or sha256 hash of a text",
+	"/base64/encode":           "Encodes the request body to base64",
+	"/base64/decode":           "Decodes a base64 request body",
+	"/upload":                  "Stores an uploaded file",
+	"/download/{name}":         "Downloads a file stored with /upload",
+	"/login":                   "Gives a token for the user in LOGIN_USER",
+	"/me":                      "The claims of your token",
+	"/kv":                      "Creates an entry in the key-value store",
+	"/kv/{key}":                "Reads, changes or deletes an entry in the key-value store",
+	"/notes":                   "Creates or lists notes",
+	"/notes/{id}":              "Reads, changes or deletes a note",
+	"/todos":                   "Creates todos, or lists them a page at a time",
+	"/todos/{id}":              "Reads, changes or deletes a todo",
+	"/":                        "This page",
+	"/health":                  "Whether the server is alive",
+	"/ready":                   "Whether the server wants traffic",
+	"/version":                 "The version of the program",
+	"/routes":                  "All endpoints as JSON",
+	"/openapi.json":            "A description of the API in the OpenAPI format",
+	"/docs":                    "Documentation of the API where requests can be tried",
+	"/metrics":                 "Metrics for Prometheus",
+	"/static/":                 "Files from the static directory",
+	"/proxy/":                  "Requests forwarded to the upstream server",
+	"/admin/stats":             "Statistics about the stores (needs a password)",
+	"/admin/routes":            "Like /routes (needs a password)",
+	"/admin/metrics":           "Like /metrics (needs a password)",
+}
+
+// routePattern matches the pattern part of a path variable, like the
+// :[0-9]+ in {id:[0-9]+}, which isn't interesting to a reader.
+var routePattern = regexp.MustCompile(`:[^}]*`)
+
+// currentRoutes returns the routes of router like collectRoutes, but leaves
+// out the deprecated paths without /v1, since the /v1 ones should be used.
+func currentRoutes(router *mux.Router) []routeInfo {
+	all := collectRoutes(router)
+	paths := map[string]bool{}
+	for _, route := range all {
+		paths[route.Path] = true
+	}
+
+	routes := []routeInfo{}
+	for _, route := range all {
+		if !paths["/v1"+route.Path] {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+type landingRoute struct {
+	Path        string
+	Methods     string
+	Description string
+}
+
+func landingPage(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The list comes from the router itself, so a new endpoint shows up here without changing the page
+		routes := []landingRoute{}
+		for _, route := range currentRoutes(router) {
+			path := routePattern.ReplaceAllString(route.Path, "")
+			methods := strings.Join(route.Methods, ", ")
+			if methods == "" {
+				methods = "any"
+			}
+			routes = append(routes, landingRoute{
+				Path:        path,
+				Methods:     methods,
+				Description: routeDescriptions[strings.TrimPrefix(path, "/v1")],
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		indexTemplate.Execute(w, routes)
+	})
+}
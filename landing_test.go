@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLandingPage(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serveRequest(router, "GET", "/", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/html", got)
+	}
+
+	page := rec.Body.String()
+	for _, want := range []string{
+		"<code>/v1/hello</code>",
+		"<code>/v1/notes/{id}</code>",
+		"<code>/health</code>",
+		"<code>/docs</code>",
+		routeDescriptions["/hash/{algo}"],
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the landing page has no %s", want)
+		}
+	}
+
+	// The deprecated paths without /v1 are left out
+	if strings.Contains(page, "<code>/hello</code>") {
+		t.Error("the landing page lists the deprecated /hello")
+	}
+}
+
+func TestLandingPageListsNewRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/<b>bold</b>", hello).Methods("GET")
+	router.Handle("/", landingPage(router))
+
+	// A new route shows up by itself, and html/template escapes it
+	page := serveRequest(router, "GET", "/", "").Body.String()
+	if !strings.Contains(page, "<code>/&lt;b&gt;bold&lt;/b&gt;</code>") || strings.Contains(page, "<b>bold</b>") {
+		t.Errorf("the new route isn't listed escaped:\n%s", page)
+	}
+}
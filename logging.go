@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logger writes structured log records as JSON lines, which log collectors
+// can parse without guessing. main replaces it with one using LOG_LEVEL.
+var logger = newLogger(os.Stdout, slog.LevelInfo)
+
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+func resolveLogLevel() (slog.Level, error) {
+	/*
+		LOG_LEVEL is one of debug, info, warn or error. Only records at that level
+		or above are written, so debug shows everything and error the least.
+	*/
+	value := os.Getenv("LOG_LEVEL")
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", value)
+	}
+	return level, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogRecord(t *testing.T) {
+	logs := captureLogs(t)
+	serveRequest(loggingMiddleware(http.HandlerFunc(hello)), "GET", "/v1/hello?name=yoda", "")
+
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want 1", len(records))
+	}
+	record := records[0]
+
+	want := map[string]interface{}{
+		"level":  "INFO",
+		"msg":    "request",
+		"method": "GET",
+		"path":   "/v1/hello",
+		"status": float64(http.StatusOK),
+	}
+	for field, value := range want {
+		if record[field] != value {
+			t.Errorf("logged %s %v, want %v", field, record[field], value)
+		}
+	}
+	if d, ok := record["duration_ms"].(float64); !ok || d < 0 {
+		t.Errorf("logged duration_ms %v, want a number", record["duration_ms"])
+	}
+	if _, ok := record["time"]; !ok {
+		t.Error("the record has no time")
+	}
+}
+
+func TestResolveLogLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{value: "", want: slog.LevelInfo},
+		{value: "debug", want: slog.LevelDebug},
+		{value: "warn", want: slog.LevelWarn},
+		{value: "ERROR", want: slog.LevelError},
+		{value: "loud", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.value)
+			got, err := resolveLogLevel()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LOG_LEVEL=%q gave no error", tt.value)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("LOG_LEVEL=%q gave %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+
+	// Records below the level are left out
+	var buf bytes.Buffer
+	l := newLogger(&buf, slog.LevelWarn)
+	l.Info("hidden")
+	l.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") {
+		t.Errorf("a warn logger wrote %q", out)
+	}
+}
+
+func TestRequestLogThroughHandler(t *testing.T) {
+	// The logger writes into a buffer instead of stdout, at the lowest level
+	var buf bytes.Buffer
+	previous := logger
+	logger = newLogger(&buf, slog.LevelDebug)
+	t.Cleanup(func() { logger = previous })
+
+	cfg := defaultConfig()
+	shared := testServices(t)
+	router, err := buildRouter(cfg, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+
+	req := httptest.NewRequest("POST", "/v1/hello", strings.NewReader(`{"name": "Yoda"}`))
+	req.Header.Set("X-Request-ID", "sample-request")
+	rec := httptest.NewRecorder()
+	newHandler(cfg, router, shared).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /v1/hello = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+
+	// Every line is one JSON record, and the request is the one with msg "request"
+	var record map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("log line is not JSON: %v\n%s", err, line)
+		}
+		if r["msg"] == "request" {
+			record = r
+		}
+	}
+	if record == nil {
+		t.Fatalf("no request was logged:\n%s", buf.String())
+	}
+
+	want := map[string]interface{}{
+		"level":      "INFO",
+		"method":     "POST",
+		"path":       "/v1/hello",
+		"status":     float64(http.StatusOK),
+		"request_id": "sample-request",
+	}
+	for field, value := range want {
+		if record[field] != value {
+			t.Errorf("logged %s %v, want %v", field, record[field], value)
+		}
+	}
+	if _, ok := record["duration_ms"].(float64); !ok {
+		t.Errorf("logged duration_ms %v, want a number", record["duration_ms"])
+	}
+}
@@ -1,21 +1,317 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/gorilla/mux"
 )
 
+// startTime is when the program started, used to report the uptime in /health.
+var startTime = time.Now()
+
 /*
 	The main function starts the entire program. It starts by creating a new
 	router that makes sure that each request gets handled by the correct function.
 */
 func main() {
+	/*
+		Command-line flags are parsed before anything else. The -addr flag lets
+		you choose which address and port to listen on, e.g. -addr 127.0.0.1:8080,
+		while -port only changes the port. -addr wins if both are given. -config
+		reads the settings from a file, see resolveConfig for which source wins.
+	*/
+	var f flags
+	flag.StringVar(&f.addr, "addr", "", "address to listen on as host:port (default \":5000\")")
+	flag.StringVar(&f.port, "port", "", "port to listen on, overrides the PORT environment variable (default \"5000\")")
+	flag.StringVar(&f.tlsCert, "tls-cert", "", "TLS certificate file to serve HTTPS, overrides TLS_CERT_FILE")
+	flag.StringVar(&f.tlsKey, "tls-key", "", "TLS private key file to serve HTTPS, overrides TLS_KEY_FILE")
+	flag.StringVar(&f.staticDir, "static-dir", "", "directory with the files served under /static/, overrides STATIC_DIR (default \"public\")")
+	flag.BoolVar(&f.pprof, "pprof", false, "serve profiling data under /debug/pprof/, same as ENABLE_PPROF=true")
+	flag.StringVar(&f.config, "config", "", "JSON or YAML file with settings, overridden by environment variables and flags")
+	flag.Parse()
+
+	level, err := resolveLogLevel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger = newLogger(os.Stdout, level)
+
+	cfg, err := resolveConfig(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	problemJSON = cfg.ProblemJSON
+	trustProxy = cfg.TrustProxy
+
+	adminUser, adminPass, err := resolveBasicAuth()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if adminUser == "" {
+		logger.Warn("ADMIN_USER and ADMIN_PASS are not set, the /admin endpoints will refuse every request")
+	}
+
+	jwtSecret := resolveJWTSecret()
+	if len(jwtSecret) == 0 {
+		logger.Warn("JWT_SECRET is not set, endpoints that need a token will refuse every request")
+	}
+
+	loginUser, loginPass, err := resolveLoginCredentials()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if loginUser == "" {
+		logger.Warn("LOGIN_USER and LOGIN_PASS are not set, POST /login will refuse every request")
+	}
+
+	/*
+		With DB_PATH set the todos are kept in a SQLite database, so they are
+		still there after a restart. Otherwise they are kept in memory like the
+		other resources. Both work with the same handlers through TodoRepository.
+	*/
+	var todos TodoRepository = newMemoryTodos()
+	if cfg.DBPath != "" {
+		db, err := openSQLiteTodos(cfg.DBPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not open the database in DB_PATH:", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		todos = db
+		logger.Info("storing todos in SQLite", "path", cfg.DBPath)
+	}
+
+	/*
+		The state shared by the handlers, like the in-memory stores, is created
+		once and handed to buildRouter, so every route uses the same data.
+	*/
+	shared := &services{
+		kv:             newStore(),
+		notes:          newNoteStore(),
+		todos:          todos,
+		jwtSecret:      jwtSecret,
+		maxPrintBytes:  cfg.MaxPrintBytes,
+		uploadDir:      cfg.UploadDir,
+		maxUploadBytes: cfg.MaxUploadBytes,
+		adminUser:      adminUser,
+		adminPass:      adminPass,
+		loginUser:      loginUser,
+		loginPass:      loginPass,
+		metrics:        newMetrics(),
+	}
+
+	router, err := buildRouter(cfg, shared)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	scheme := "http"
+	if cfg.TLSCertFile != "" {
+		scheme = "https"
+	}
+
+	logger.Info("starting server",
+		"addr", cfg.listenAddr(),
+		"addr_source", cfg.addrSource,
+		"mode", strings.ToUpper(scheme),
+		"url", scheme+"://"+displayAddr(cfg.listenAddr()),
+	)
+
+	/*
+		signal.NotifyContext gives us a context that is cancelled as soon as the
+		program is asked to stop, so serve can shut the server down gracefully.
+	*/
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := newServer(cfg, newHandler(cfg, router, shared))
+
+	/*
+		The most common reason the server can't start is another program (or
+		another copy of this one) already using the port. errors.Is finds the
+		EADDRINUSE error from the operating system inside the error of net.Listen.
+	*/
+	if err := serve(ctx, srv, cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			fmt.Fprintf(os.Stderr, "%s is already in use by another program, stop it or choose another port, e.g. PORT=%d go run .\n", cfg.listenAddr(), defaultPort+1)
+		} else {
+			fmt.Fprintln(os.Stderr, "the server stopped:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// newHandler wraps the router in the middleware that runs for every request,
+// also the ones that don't match any route.
+func newHandler(cfg *Config, router *mux.Router, shared *services) http.Handler {
+	/*
+		chain applies the middleware in the order they are listed, so the first
+		one sees the request first and the response last. recoverMiddleware is
+		inside loggingMiddleware and the metrics, so the 500 it answers for a
+		panic is what gets logged and counted.
+	*/
+	limiter := newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	securityHeaders := securityHeadersMiddleware(cfg.ContentSecurityPolicy)
+	return chain(router,
+		requestIDMiddleware,                                         // gives every request an ID for the logs and the response
+		securityHeaders,                                             // tells browsers to be stricter with the responses
+		loggingMiddleware,                                           // logs every request with its status and duration
+		shared.metrics.middleware(router),                           // counts and times requests for /metrics
+		recoverMiddleware,                                           // turns a panic in a handler into a 500 response
+		gzipMiddleware,                                              // compresses responses for clients that support it
+		limiter.middleware,                                          // answers 429 to clients sending too many requests
+		maxBodyBytesMiddleware(cfg.MaxBodyBytes),                    // limits the size of request bodies
+		bodyLoggingMiddleware(cfg.LogBodies),                        // logs request bodies when LOG_BODIES=true
+		corsMiddleware(cfg.CORSOrigins),                             // lets browsers call the API from other origins
+		timeoutMiddleware(cfg.RequestTimeout.Duration, pprofPrefix), // answers 503 when a handler takes too long, except for profiles
+	)
+}
+
+// services holds the state shared by the handlers, see buildRouter.
+type services struct {
+	kv             *store
+	notes          *noteStore
+	todos          TodoRepository
+	jwtSecret      []byte
+	maxPrintBytes  int
+	uploadDir      string
+	maxUploadBytes int64
+	adminUser      string
+	adminPass      string
+	loginUser      string
+	loginPass      string
+	metrics        *metrics
+}
+
+// buildRouter registers every route on a new router, using the settings in
+// cfg and the state in shared. main wraps the result in the middleware.
+func buildRouter(cfg *Config, shared *services) (*mux.Router, error) {
 	router := mux.NewRouter()
 
+	/*
+		All API endpoints live under /v1. PathPrefix matches every path starting
+		with /v1, and Subrouter gives a router whose routes are relative to that
+		prefix. A future incompatible version gets its own registerV2Routes
+		function on a /v2 subrouter, while /v1 keeps working for older clients.
+	*/
+	registerV1Routes(router.PathPrefix("/v1").Subrouter(), shared)
+
+	/*
+		The same endpoints are also registered without the /v1 prefix, because
+		that's where they used to be. They are deprecated, which the middleware
+		tells clients with the Deprecation header, and will be removed later.
+	*/
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(deprecatedMiddleware)
+	registerV1Routes(legacy, shared)
+
+	/*
+		These endpoints are about the server itself rather than the API, so they
+		aren't versioned. Load balancers and orchestrators call /health to check that
+		the server is alive, and /ready to check if it wants traffic, which isn't
+		the case while it starts or stops.
+	*/
+	router.HandleFunc("/health", health).Methods("GET")
+	router.HandleFunc("/ready", readiness).Methods("GET")
+	router.HandleFunc("/version", getVersion).Methods("GET")
+
+	/*
+		/routes lists all the routes of the router, so it needs the router itself.
+		The landing page on / shows the same list as a web page.
+	*/
+	router.Handle("/routes", listRoutes(router)).Methods("GET")
+	router.Handle("/", landingPage(router)).Methods("GET")
+
+	/*
+		/openapi.json describes the same routes in the OpenAPI format, for tools,
+		and /docs shows that description as a page where requests can be tried.
+	*/
+	router.Handle("/openapi.json", openAPISpec(router)).Methods("GET")
+	docs := apiDocs()
+	router.Handle("/docs", docs).Methods("GET")
+	router.PathPrefix("/docs/").Handler(docs).Methods("GET")
+
+	// /metrics is scraped by Prometheus to monitor the requests the server handles
+	router.Handle("/metrics", shared.metrics.handler()).Methods("GET")
+
+	/*
+		Files in the static directory are served under /static/, e.g.
+		public/style.css as /static/style.css. StripPrefix removes /static/ from
+		the path first, so the file server looks for style.css in the directory.
+	*/
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticFiles(cfg.StaticDir)))
+
+	/*
+		With UPSTREAM_URL set, /proxy/ forwards requests to that server, e.g.
+		/proxy/users?page=2 to http://localhost:8080/users?page=2. StripPrefix
+		removes /proxy first. Without it the route isn't registered at all, so
+		/proxy/ answers 404 like any other unknown path.
+	*/
+	if cfg.UpstreamURL != "" {
+		proxy, err := newReverseProxy(cfg.UpstreamURL)
+		if err != nil {
+			return nil, err
+		}
+		router.PathPrefix("/proxy/").Handler(http.StripPrefix("/proxy", proxy))
+		logger.Info("proxying requests", "path", "/proxy/", "upstream", cfg.UpstreamURL)
+	}
+
+	/*
+		The profiling endpoints show a lot about the inside of the program, so
+		they are only there when asked for, and the log says so at startup.
+	*/
+	if cfg.EnablePprof {
+		registerPprofRoutes(router)
+		logger.Warn("profiling is enabled", "path", "/debug/pprof/")
+	}
+
+	/*
+		The /admin endpoints need a username and password. Use on a subrouter only
+		runs the middleware for the routes of that subrouter, so every other
+		endpoint stays public.
+
+		/admin/routes and /admin/metrics are the same as /routes and /metrics,
+		for setups where those are blocked from the public.
+	*/
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(basicAuthMiddleware(shared.adminUser, shared.adminPass))
+	admin.HandleFunc("/stats", adminStats(shared)).Methods("GET")
+	admin.Handle("/routes", listRoutes(router)).Methods("GET")
+	admin.Handle("/metrics", shared.metrics.handler()).Methods("GET")
+
+	/*
+		When no route matches, the router calls NotFoundHandler, and when the path
+		matches but the method doesn't it calls MethodNotAllowedHandler. By default
+		they answer in plain text, so here they are replaced to answer in JSON.
+	*/
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = methodNotAllowed(router)
+
+	return router, nil
+}
+
+// registerV1Routes registers the endpoints of version 1 of the API on router.
+func registerV1Routes(router *mux.Router, shared *services) {
 	/*
 		Each router.HandleFunc method handles a route and attaches a function to a
 		route (url path) that takes care of these requests. Here we attach /hello
@@ -27,27 +323,116 @@ func main() {
 	router.HandleFunc("/hello", hello).Methods("GET")
 
 	// You can have a different function to handle POST request to the same path
-	router.HandleFunc("/hello", postHello).Methods("GET")
+	router.HandleFunc("/hello", postHello).Methods("POST")
 
 	/*
 		A path can contain dynamic parameters which can either contain anything or a certain
-		pattern. This parameter can contain anything.
+		pattern. This parameter has to match the regular expression after the colon, so it
+		may only contain letters, digits, spaces, underscores and dashes, and control
+		characters ([:cntrl:], which includes tabs and newlines). Anything else, like a slash
+		or <, doesn't match the route and gets a 404. Control characters do match, so print
+		can answer them with a 400 that explains the problem, and allow the whitespace ones.
+	*/
+	router.HandleFunc("/print/{what_to_print:[A-Za-z0-9 _[:cntrl:]-]+}", print(shared.maxPrintBytes)).Methods("GET")
+
+	// The {mode} pattern only allows the modes textTransforms knows, like upper and lower
+	router.HandleFunc("/transform/{mode:upper|lower}/{text}", transform(shared.maxPrintBytes)).Methods("GET")
+	router.HandleFunc("/reverse/{text}", reverse(shared.maxPrintBytes)).Methods("GET")
+
+	/*
+		The function name doesn't have to be the same as the path name. withETag
+		adds an ETag header, so a client polling the endpoint gets 304 Not Modified
+		when nothing changed since its last request.
 	*/
-	router.HandleFunc("/print/{what_to_print}", print).Methods("GET")
+	router.HandleFunc("/system", withETag(getSystemInfo)).Methods("GET")
 
-	// The function name doesn't have to be the same as the path name
-	router.HandleFunc("/system", getSystemInfo).Methods("GET")
+	// /system/stream sends the same information every second as Server-Sent Events
+	router.HandleFunc("/system/stream", systemStream).Methods("GET")
+
+	// /events/time sends the current time every second in the same way
+	router.HandleFunc("/events/time", timeStream).Methods("GET")
 
 	router.HandleFunc("/request-info/{params}", requestInfo)
 
-	port := "5000"
+	/*
+		/echo works with every method and sends back everything it received,
+		including the body. It used to send back only the raw body, which
+		moved to /echo/raw so clients relying on that can still have it.
+	*/
+	router.HandleFunc("/echo", echo)
+
+	// /echo/raw sends the body of the request back exactly as it was received
+	router.HandleFunc("/echo/raw", echoRaw).Methods("POST")
 
-	fmt.Printf("Running on http://localhost:%s\n", port)
+	// /whoami tells the client which IP address the server sees for it
+	router.HandleFunc("/whoami", whoami).Methods("GET")
 
-	err := http.ListenAndServe(":"+port, router)
-	if err != nil {
-		panic(err)
-	}
+	// /ws/echo upgrades the connection to a WebSocket and sends every message back
+	router.HandleFunc("/ws/echo", wsEcho).Methods("GET")
+
+	router.HandleFunc("/uuid", getUUID).Methods("GET")
+	router.HandleFunc("/random", getRandom).Methods("GET")
+	router.HandleFunc("/time", getTime).Methods("GET")
+
+	// The algorithm comes from the path and the text to hash from the query
+	router.HandleFunc("/hash/{algo}", getHash).Methods("GET")
+
+	// Both base64 endpoints work on the raw body of the request
+	router.HandleFunc("/base64/encode", base64Encode).Methods("POST")
+	router.HandleFunc("/base64/decode", base64Decode).Methods("POST")
+
+	/*
+		Files from /upload are stored in the upload directory. The handler makes
+		up the name of the stored file, so clients can't choose where it goes.
+		/download/{name} sends a stored file back.
+	*/
+	router.HandleFunc("/upload", upload(shared.uploadDir, shared.maxUploadBytes)).Methods("POST")
+	router.HandleFunc("/download/{name}", download(shared.uploadDir)).Methods("GET")
+
+	/*
+		/login gives out a JWT, which /me needs in the Authorization header.
+		requireAuth only wraps this one handler, so every other endpoint stays public.
+	*/
+	router.HandleFunc("/login", login(shared.jwtSecret, shared.loginUser, shared.loginPass)).Methods("POST")
+	router.Handle("/me", requireAuth(shared.jwtSecret, me)).Methods("GET")
+
+	/*
+		The key-value store shows a full CRUD resource (Create, Read, Update and
+		Delete). Its handlers are methods on the store, so they all share the same data.
+	*/
+	kv := shared.kv
+	router.HandleFunc("/kv", kv.create).Methods("POST")
+	router.HandleFunc("/kv/{key}", withETag(kv.get)).Methods("GET")
+	router.HandleFunc("/kv/{key}", kv.update).Methods("PUT")
+	router.HandleFunc("/kv/{key}", kv.delete).Methods("DELETE")
+
+	/*
+		Notes are another CRUD resource, where the server picks the ID. The
+		{id:[0-9]+} pattern makes the route only match numbers, so the handlers
+		can be sure the ID converts to an int.
+	*/
+	notes := shared.notes
+	router.HandleFunc("/notes", notes.create).Methods("POST")
+	router.HandleFunc("/notes", withETag(notes.list)).Methods("GET")
+	router.HandleFunc("/notes/{id:[0-9]+}", withETag(notes.get)).Methods("GET")
+	router.HandleFunc("/notes/{id:[0-9]+}", notes.update).Methods("PUT")
+	router.HandleFunc("/notes/{id:[0-9]+}", notes.delete).Methods("DELETE")
+
+	// Todos work like notes, but GET /todos sends the list in pages
+	todos := &todoAPI{repo: shared.todos}
+	router.HandleFunc("/todos", todos.create).Methods("POST")
+	router.HandleFunc("/todos", withETag(todos.list)).Methods("GET")
+	router.HandleFunc("/todos/{id:[0-9]+}", withETag(todos.get)).Methods("GET")
+	router.HandleFunc("/todos/{id:[0-9]+}", todos.update).Methods("PUT")
+	router.HandleFunc("/todos/{id:[0-9]+}", todos.delete).Methods("DELETE")
+}
+
+func deprecatedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The Deprecation header tells clients to move to the /v1 paths
+		w.Header().Set("Deprecation", "true")
+		next.ServeHTTP(w, r)
+	})
 }
 
 func hello(w http.ResponseWriter, r *http.Request) {
@@ -58,9 +443,33 @@ func hello(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Hello to you too!")
 }
 
+// helloInput is the JSON body postHello expects. Decoding into a struct
+// instead of a map means the handler knows exactly what it gets, and the
+// validate tag says which rules the fields have to follow.
+type helloInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
 func postHello(w http.ResponseWriter, r *http.Request) {
-	var body map[string]interface{}
-	json.NewDecoder(r.Body).Decode(&body)
+	var input helloInput
+
+	/*
+		Decode returns an error if the client sent something that isn't valid JSON
+		or too much of it. DisallowUnknownFields makes it an error too when the
+		body has fields that helloInput doesn't have, which are often typos. An
+		empty body gives the special io.EOF error, which is treated like an empty
+		JSON object, so the client is told that name is required.
+	*/
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&input)
+	if err == nil || err == io.EOF {
+		err = validate.Struct(input)
+	}
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
 
 	/*
 		A map is created to store multiple key-value pairs. Here it stores key value pairs of
@@ -71,27 +480,54 @@ func postHello(w http.ResponseWriter, r *http.Request) {
 	output := map[string]interface{}{
 		"endpoint":        "hello",
 		"function":        "postHello",
-		"what_did_i_send": body,
+		"greeting":        "Hello, " + input.Name + "!",
+		"what_did_i_send": input,
 	}
 
 	/*
-		To deliver the data to the user in JSON format, a json encoder is used where
-		the output variable is encoded using a new json encoder based on the
-		http.ResponseWriter w (it acts as a channel to write through).
+		To deliver the data to the user in JSON format, the writeSuccess helper puts
+		the output variable under "data", sets the JSON content type, writes the
+		status code and encodes it.
 	*/
-	json.NewEncoder(w).Encode(output)
+	writeSuccess(w, r, http.StatusOK, output)
 }
 
-func print(w http.ResponseWriter, r *http.Request) {
-	/*
-		To fetch dynamic url parameters, use mux.Vars and use the *http.Request parameter as input.
-		mux.Vars(r) returns a key-value pair of all potentiel url parameters in the path.
-		In this case there's only one and it's called what_to_print.
+func print(maxBytes int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		/*
+			To fetch dynamic url parameters, use mux.Vars and use the *http.Request parameter as input.
+			mux.Vars(r) returns a key-value pair of all potentiel url parameters in the path.
+			In this case there's only one and it's called what_to_print.
 
-		An example of returning the full mux.Vars output as JSON can be found in the requestInfo function.
-	*/
-	text_to_print := mux.Vars(r)["what_to_print"]
-	fmt.Fprint(w, text_to_print)
+			An example of returning the full mux.Vars output as JSON can be found in the requestInfo function.
+		*/
+		text_to_print := mux.Vars(r)["what_to_print"]
+
+		// The route pattern decides which characters are allowed, but not how many
+		if len(text_to_print) > maxBytes {
+			writeAPIError(w, r, http.StatusBadRequest, "text_too_long", fmt.Sprintf("what_to_print is longer than %d bytes", maxBytes))
+			return
+		}
+
+		/*
+			Control characters like a NUL byte or an escape can mess up a terminal
+			or a log that shows the text, so they are refused. Tabs and newlines
+			are control characters too, but also whitespace, so they are allowed.
+		*/
+		for _, c := range text_to_print {
+			if unicode.IsControl(c) && !unicode.IsSpace(c) {
+				writeAPIError(w, r, http.StatusBadRequest, "invalid_characters", "what_to_print must not contain control characters other than whitespace")
+				return
+			}
+		}
+
+		/*
+			Without a Content-Type the client (or browser) has to guess what the
+			body is, so we tell it that it's plain text.
+		*/
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, text_to_print)
+	}
 }
 
 func getSystemInfo(w http.ResponseWriter, r *http.Request) {
@@ -100,31 +536,303 @@ func getSystemInfo(w http.ResponseWriter, r *http.Request) {
 		from the runtime environment using the runtime package. This gives info
 		about the servers' system info - not the client.
 	*/
-	system_info := map[string]string{
-		"operating_system":    runtime.GOOS,
-		"system_architecture": runtime.GOARCH,
-	}
+	system_info := systemInfo()
 
 	/*
-		To deliver the data to the user in JSON format, a json encoder is used where
-		the system_info variable is encoded using a new json encoder based on the
-		http.ResponseWriter w (it acts as a channel to write through).
+		The respond helper delivers the data in XML format if the client asks for it
+		in the Accept header, and in JSON format otherwise.
 	*/
-	json.NewEncoder(w).Encode(system_info)
+	respond(w, r, http.StatusOK, system_info)
+}
+
+// SystemInfo holds the response of the /system endpoint. A struct is used
+// instead of a map because the xml package can only encode structs. The tags
+// after each field tell the json and xml packages what to call the field.
+type SystemInfo struct {
+	XMLName            xml.Name `json:"-" xml:"system_info"`
+	OperatingSystem    string   `json:"operating_system" xml:"operating_system"`
+	SystemArchitecture string   `json:"system_architecture" xml:"system_architecture"`
+	GoVersion          string   `json:"go_version" xml:"go_version"`
+	NumCPU             int      `json:"num_cpu" xml:"num_cpu"`
+	NumGoroutine       int      `json:"num_goroutine" xml:"num_goroutine"`
+	AllocBytes         uint64   `json:"alloc_bytes" xml:"alloc_bytes"`
+	TotalAllocBytes    uint64   `json:"total_alloc_bytes" xml:"total_alloc_bytes"`
+	SysBytes           uint64   `json:"sys_bytes" xml:"sys_bytes"`
+	NumGC              uint32   `json:"num_gc" xml:"num_gc"`
+}
+
+func systemInfo() SystemInfo {
+	/*
+		runtime.ReadMemStats fills a runtime.MemStats struct with statistics about
+		the memory used by the program.
+	*/
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return SystemInfo{
+		OperatingSystem:    runtime.GOOS,
+		SystemArchitecture: runtime.GOARCH,
+		GoVersion:          runtime.Version(),
+		NumCPU:             runtime.NumCPU(),
+		NumGoroutine:       runtime.NumGoroutine(),
+		AllocBytes:         mem.Alloc,
+		TotalAllocBytes:    mem.TotalAlloc,
+		SysBytes:           mem.Sys,
+		NumGC:              mem.NumGC,
+	}
+}
+
+// RequestInfo holds the response of the /request-info endpoint. The maps use
+// the xmlMap and xmlMultiMap types, which work like normal maps but also know
+// how to encode themselves as XML.
+type RequestInfo struct {
+	XMLName              xml.Name    `json:"-" xml:"request_info"`
+	DynamicURLParameters xmlMap      `json:"dynamic_url_parameters" xml:"dynamic_url_parameters"`
+	Path                 string      `json:"path" xml:"path"`
+	QueryParameters      xmlMultiMap `json:"query_parameters" xml:"query_parameters"`
+	HTTPMethod           string      `json:"http_method" xml:"http_method"`
+	Host                 string      `json:"host" xml:"host"`
+	Headers              xmlMultiMap `json:"headers" xml:"headers"`
+	RemoteAddr           string      `json:"remote_addr" xml:"remote_addr"`
+	Cookies              xmlMap      `json:"cookies" xml:"cookies"`
+	ContentLength        int64       `json:"content_length" xml:"content_length"`
+	Protocol             string      `json:"protocol" xml:"protocol"`
+	TLS                  bool        `json:"tls" xml:"tls"`
 }
 
 func requestInfo(w http.ResponseWriter, r *http.Request) {
 	/*
 		This example gets you the most important things to get from a request through a web
-		service (API) and sends the data encoded in JSON format.
+		service (API) and sends the data encoded in JSON or XML format.
 	*/
-	request_info := map[string]interface{}{
-		"dynamic_url_parameters": mux.Vars(r),
-		"path":                   r.URL.Path,
-		"query_parameters":       r.URL.Query(),
-		"http_method":            r.Method,
-		"host":                   r.Host,
-		"headers":                r.Header,
+	request_info := newRequestInfo(r)
+	respond(w, r, http.StatusOK, request_info)
+}
+
+// newRequestInfo collects the information about r that /request-info and
+// /echo respond with.
+func newRequestInfo(r *http.Request) RequestInfo {
+	request_info := RequestInfo{
+		DynamicURLParameters: mux.Vars(r),
+		Path:                 r.URL.Path,
+		QueryParameters:      xmlMultiMap(r.URL.Query()),
+		HTTPMethod:           r.Method,
+		Host:                 r.Host,
+		Headers:              xmlMultiMap(r.Header),
+		Cookies:              xmlMap{},
+
+		/*
+			RemoteAddr is the address of whoever opened the connection, which is a
+			proxy if there's one in between. ContentLength is -1 when the length of
+			the body isn't known, and r.TLS is only set for HTTPS requests.
+		*/
+		RemoteAddr:    r.RemoteAddr,
+		ContentLength: r.ContentLength,
+		Protocol:      r.Proto,
+		TLS:           r.TLS != nil,
+	}
+	for _, cookie := range r.Cookies() {
+		request_info.Cookies[cookie.Name] = cookie.Value
 	}
-	json.NewEncoder(w).Encode(request_info)
+	return request_info
+}
+
+// EchoInfo holds the response of the /echo endpoint: the same information as
+// /request-info, with the body of the request added. Embedding RequestInfo
+// puts its fields directly in the JSON object next to body.
+type EchoInfo struct {
+	RequestInfo
+	Body interface{} `json:"body"`
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	/*
+		io.ReadAll reads the whole body, up to the limit set by maxBodyBytesMiddleware.
+		Nothing is decoded yet, so any kind of body works, not only JSON.
+	*/
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return
+	}
+
+	/*
+		A JSON body is sent back as JSON, so it shows up as an object instead of
+		a string full of escaped quotes. json.RawMessage keeps it exactly as it
+		was sent. Any other body is sent back as a string, and no body as null.
+	*/
+	echo_info := EchoInfo{RequestInfo: newRequestInfo(r)}
+	switch {
+	case len(body) == 0:
+		echo_info.Body = nil
+	case json.Valid(body):
+		echo_info.Body = json.RawMessage(body)
+	default:
+		echo_info.Body = string(body)
+	}
+
+	writeSuccess(w, r, http.StatusOK, echo_info)
+}
+
+func echoRaw(w http.ResponseWriter, r *http.Request) {
+	/*
+		io.ReadAll reads the whole body, up to the limit set by maxBodyBytesMiddleware.
+		Nothing is decoded, so any kind of body works, not only JSON.
+	*/
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, r, err)
+		return
+	}
+
+	/*
+		The response gets the same Content-Type as the request. Since the body
+		comes from the client, the sandbox policy stops a browser from running any
+		scripts in it, in case someone sends HTML.
+	*/
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func whoami(w http.ResponseWriter, r *http.Request) {
+	/*
+		This is the same address the rate limiter uses to tell clients apart.
+		"via" says where it came from, which helps to find out why it isn't the
+		expected one, e.g. if TRUST_PROXY isn't set or a proxy in front of the
+		server doesn't set X-Forwarded-For.
+	*/
+	ip, via := resolveClientIP(r)
+	writeSuccess(w, r, http.StatusOK, map[string]string{"ip": ip, "via": via})
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	/*
+		This endpoint doesn't depend on anything outside the program, so as long as
+		the process is alive it answers 200 OK. time.Since gives the time passed
+		since startTime, and Seconds converts it to a float.
+	*/
+	writeSuccess(w, r, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": time.Since(startTime).Seconds(),
+	})
+}
+
+func readiness(w http.ResponseWriter, r *http.Request) {
+	/*
+		Unlike /health, this endpoint answers 503 Service Unavailable when the
+		server is alive but shouldn't receive traffic, e.g. during shutdown.
+		Both answers have the ready field, so a probe only has to check that,
+		and the 503 is not an error of the client, so it isn't sent as one.
+	*/
+	if !ready() {
+		writeSuccess(w, r, http.StatusServiceUnavailable, map[string]bool{"ready": false})
+		return
+	}
+	writeSuccess(w, r, http.StatusOK, map[string]bool{"ready": true})
+}
+
+func adminStats(shared *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		todos, err := shared.todos.Count()
+		if err != nil {
+			writeStorageError(w, r, err)
+			return
+		}
+		writeSuccess(w, r, http.StatusOK, map[string]interface{}{
+			"kv_entries":     shared.kv.len(),
+			"notes":          shared.notes.len(),
+			"todos":          todos,
+			"uptime_seconds": time.Since(startTime).Seconds(),
+		})
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if problemJSON {
+		writeProblem(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound), "not found")
+		return
+	}
+
+	// The requested path is included to make it easy to spot typos
+	writeJSON(w, r, http.StatusNotFound, map[string]interface{}{
+		"error": APIError{Code: "not_found", Message: "not found"},
+		"path":  r.URL.Path,
+	})
+}
+
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/*
+			A 405 response should have an Allow header listing the methods that do
+			work. router.Walk visits every route, and for each method a route accepts
+			we check if the route would match this request using that method.
+		*/
+		var allowed []string
+		router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			methods, err := route.GetMethods()
+			if err != nil {
+				return nil
+			}
+			for _, method := range methods {
+				attempt := r.Clone(r.Context())
+				attempt.Method = method
+				if route.Match(attempt, &mux.RouteMatch{}) {
+					allowed = append(allowed, method)
+				}
+			}
+			return nil
+		})
+
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	})
+}
+
+// routeInfo describes one route in the /routes response.
+type routeInfo struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+func listRoutes(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSuccess(w, r, http.StatusOK, collectRoutes(router))
+	})
+}
+
+func collectRoutes(router *mux.Router) []routeInfo {
+	/*
+		router.Walk calls the function for every registered route. GetPathTemplate
+		gives the path as it was registered, e.g. /print/{what_to_print}. Routes
+		registered without .Methods() accept any method and get an empty list.
+		A path registered several times with different methods is listed once,
+		at the position where it was first registered.
+	*/
+	routes := []routeInfo{}
+	index := map[string]int{}
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		// Routes without a handler only group other routes, like the /v1 prefix
+		path, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+
+		if i, seen := index[path]; seen {
+			routes[i].Methods = append(routes[i].Methods, methods...)
+			return nil
+		}
+		index[path] = len(routes)
+		routes = append(routes, routeInfo{Path: path, Methods: append([]string{}, methods...)})
+		return nil
+	})
+	return routes
 }
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers and middleware log every request, which would drown the test output
+	logger = newLogger(io.Discard, slog.LevelInfo)
+	os.Exit(m.Run())
+}
+
+// testServices returns the state shared by the handlers, with everything kept
+// in memory or in a temporary directory that is removed after the test.
+func testServices(t *testing.T) *services {
+	t.Helper()
+	return &services{
+		kv:             newStore(),
+		notes:          newNoteStore(),
+		todos:          newMemoryTodos(),
+		jwtSecret:      []byte("test-secret"),
+		maxPrintBytes:  defaultMaxPrintBytes,
+		uploadDir:      t.TempDir(),
+		maxUploadBytes: defaultMaxUploadBytes,
+		adminUser:      "admin",
+		adminPass:      "secret",
+		loginUser:      "yoda",
+		loginPass:      "do-or-do-not",
+		metrics:        newMetrics(),
+	}
+}
+
+// newV1Router returns a router with the version 1 endpoints registered
+// without a prefix, like the deprecated paths, and the JSON 404 and 405
+// handlers.
+func newV1Router(t *testing.T, shared *services) *mux.Router {
+	t.Helper()
+	router := mux.NewRouter()
+	registerV1Routes(router, shared)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = methodNotAllowed(router)
+	return router
+}
+
+// newTestRouter returns the router of the whole API, like main builds it,
+// with the default configuration and the services of testServices.
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	router, err := buildRouter(defaultConfig(), testServices(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// serveRequest sends a request to h and returns the recorded response. An
+// empty body sends a request without one.
+func serveRequest(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeData decodes the "data" of a success response into dst.
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, rec.Body)
+	}
+	if err := json.Unmarshal(resp.Data, dst); err != nil {
+		t.Fatalf("could not decode data: %v\n%s", err, rec.Body)
+	}
+}
+
+// decodeError decodes the "error" of an error response.
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var resp struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, rec.Body)
+	}
+	return resp.Error
+}
+
+func TestBuildRouterSmoke(t *testing.T) {
+	router := newTestRouter(t)
+
+	// The routes are registered under the names main uses
+	for _, target := range []string{"/v1/hello", "/health"} {
+		var match mux.RouteMatch
+		if !router.Match(httptest.NewRequest("GET", target, nil), &match) || match.Route == nil {
+			t.Errorf("GET %s doesn't match a route", target)
+		}
+	}
+
+	// A real server with the router answers them too
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	for _, target := range []string{"/v1/hello", "/health"} {
+		resp, err := http.Get(srv.URL + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", target, resp.StatusCode)
+		}
+	}
+}
+
+func TestHelloGetAndPost(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	rec := serveRequest(router, "GET", "/hello", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "Hello to you too!" {
+		t.Fatalf("GET /hello = %d %q, want the greeting of hello", rec.Code, rec.Body)
+	}
+
+	rec = serveRequest(router, "POST", "/hello", `{"name": "Yoda"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /hello = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+	var data struct {
+		Function string `json:"function"`
+		Greeting string `json:"greeting"`
+	}
+	decodeData(t, rec, &data)
+	if data.Function != "postHello" || data.Greeting != "Hello, Yoda!" {
+		t.Errorf("POST /hello answered %+v, want the response of postHello", data)
+	}
+}
+
+func TestPostHelloBodies(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "valid JSON", body: `{"name": "Yoda"}`, wantCode: http.StatusOK},
+		{name: "malformed JSON", body: `{"name": "Yoda"`, wantCode: http.StatusBadRequest, wantErr: "invalid_json"},
+		{name: "not JSON", body: `name=Yoda`, wantCode: http.StatusBadRequest, wantErr: "invalid_json"},
+		{name: "empty body", body: "", wantCode: http.StatusBadRequest, wantErr: "validation_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(http.HandlerFunc(postHello), "POST", "/hello", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d\n%s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantErr != "" {
+				if got := decodeError(t, rec).Code; got != tt.wantErr {
+					t.Errorf("error code = %q, want %q", got, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestPostHelloEchoesBody(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	rec := serveRequest(router, "POST", "/hello", `{"name": "Luke"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /hello = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+	var data struct {
+		Endpoint     string            `json:"endpoint"`
+		WhatDidISend map[string]string `json:"what_did_i_send"`
+	}
+	decodeData(t, rec, &data)
+	if data.Endpoint != "hello" || data.WhatDidISend["name"] != "Luke" {
+		t.Errorf("POST /hello answered %+v, want the body back under what_did_i_send", data)
+	}
+
+	// GET is still handled by hello, which answers in plain text
+	rec = serveRequest(router, "GET", "/hello", "")
+	if got := rec.Header().Get("Content-Type"); got == "application/json" {
+		t.Errorf("GET /hello answered with %s, want the plain text of hello", got)
+	}
+}
+
+func TestPostHelloErrorResponses(t *testing.T) {
+	// Malformed JSON names the problem in the message
+	rec := serveRequest(http.HandlerFunc(postHello), "POST", "/hello", `{"name": }`)
+	apiErr := decodeError(t, rec)
+	if rec.Code != http.StatusBadRequest || apiErr.Code != "invalid_json" || !strings.HasPrefix(apiErr.Message, "invalid JSON body: ") {
+		t.Errorf("malformed JSON = %d %+v, want 400 invalid_json", rec.Code, apiErr)
+	}
+
+	// An empty body is treated like {}, so the client learns that name is required
+	rec = serveRequest(http.HandlerFunc(postHello), "POST", "/hello", "")
+	apiErr = decodeError(t, rec)
+	if len(apiErr.Details) != 1 || apiErr.Details[0].Field != "name" || apiErr.Details[0].Rule != "required" {
+		t.Errorf("empty body gave details %+v, want name is required", apiErr.Details)
+	}
+
+	// A valid object has no error at all
+	rec = serveRequest(http.HandlerFunc(postHello), "POST", "/hello", `{"name": "Yoda"}`)
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusOK || apiErr.Code != "" {
+		t.Errorf("valid object = %d with error %+v, want 200 without one", rec.Code, apiErr)
+	}
+}
+
+func TestHealthUptime(t *testing.T) {
+	uptime := func() float64 {
+		t.Helper()
+		rec := serveRequest(http.HandlerFunc(health), "GET", "/health", "")
+		var data struct {
+			Status        string  `json:"status"`
+			UptimeSeconds float64 `json:"uptime_seconds"`
+		}
+		decodeData(t, rec, &data)
+		if data.Status != "ok" {
+			t.Errorf("status = %q, want ok", data.Status)
+		}
+		return data.UptimeSeconds
+	}
+
+	first := uptime()
+	time.Sleep(10 * time.Millisecond)
+	second := uptime()
+	if first < 0 || second <= first {
+		t.Errorf("uptime went from %v to %v, want it to be positive and grow", first, second)
+	}
+}
+
+func TestSystemInfoKeys(t *testing.T) {
+	rec := serveRequest(http.HandlerFunc(getSystemInfo), "GET", "/system", "")
+	var data map[string]interface{}
+	decodeData(t, rec, &data)
+
+	for _, key := range []string{"operating_system", "system_architecture", "go_version"} {
+		if value, ok := data[key].(string); !ok || value == "" {
+			t.Errorf("%s = %v, want a text", key, data[key])
+		}
+	}
+	for _, key := range []string{"num_cpu", "num_goroutine", "alloc_bytes", "total_alloc_bytes", "sys_bytes", "num_gc"} {
+		if value, ok := data[key].(float64); !ok || value < 0 {
+			t.Errorf("%s = %v, want a number of 0 or more", key, data[key])
+		}
+	}
+	if n, _ := data["num_cpu"].(float64); n < 1 {
+		t.Errorf("num_cpu = %v, want at least 1", data["num_cpu"])
+	}
+}
+
+func TestSystemInfoNumbers(t *testing.T) {
+	rec := serveRequest(http.HandlerFunc(getSystemInfo), "GET", "/system", "")
+
+	// UseNumber keeps the numbers as they were written, so they can be checked to be whole
+	decoder := json.NewDecoder(rec.Body)
+	decoder.UseNumber()
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := decoder.Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"num_cpu", "num_goroutine", "alloc_bytes", "total_alloc_bytes", "sys_bytes", "num_gc"} {
+		number, ok := resp.Data[key].(json.Number)
+		if !ok {
+			t.Errorf("%s = %#v, want a number", key, resp.Data[key])
+			continue
+		}
+		if _, err := number.Int64(); err != nil {
+			t.Errorf("%s = %s, want a whole number", key, number)
+		}
+	}
+}
+
+func TestHealthLiveness(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serveRequest(router, "GET", "/health", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health = %d, want 200", rec.Code)
+	}
+	var data map[string]interface{}
+	decodeData(t, rec, &data)
+	if _, ok := data["uptime_seconds"].(float64); !ok {
+		t.Errorf("GET /health answered %v, want an uptime_seconds number", data)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	t.Cleanup(func() { setReady(false) })
+
+	setReady(false)
+	rec := serveRequest(http.HandlerFunc(readiness), "GET", "/ready", "")
+	var notReady map[string]bool
+	decodeData(t, rec, &notReady)
+	if ready, ok := notReady["ready"]; rec.Code != http.StatusServiceUnavailable || !ok || ready {
+		t.Errorf("not ready: GET /ready = %d %v, want 503 with ready false", rec.Code, notReady)
+	}
+
+	setReady(true)
+	rec = serveRequest(http.HandlerFunc(readiness), "GET", "/ready", "")
+	var data map[string]bool
+	decodeData(t, rec, &data)
+	if rec.Code != http.StatusOK || !data["ready"] {
+		t.Errorf("ready: GET /ready = %d %v, want 200 ready", rec.Code, data)
+	}
+}
+
+func TestUnknownPathAndMethod(t *testing.T) {
+	router := newTestRouter(t)
+
+	if rec := serveRequest(router, "GET", "/does-not-exist", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /does-not-exist = %d, want 404", rec.Code)
+	}
+	for _, target := range []string{"/hello", "/v1/hello"} {
+		if rec := serveRequest(router, "DELETE", target, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("DELETE %s = %d, want 405", target, rec.Code)
+		}
+	}
+}
+
+func TestNotFoundAndMethodNotAllowedBodies(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	rec := serveRequest(router, "GET", "/nope", "")
+	var notFoundBody struct {
+		Error APIError `json:"error"`
+		Path  string   `json:"path"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &notFoundBody); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound || notFoundBody.Error.Code != "not_found" || notFoundBody.Path != "/nope" {
+		t.Errorf("GET /nope = %d %s, want 404 not_found with the path", rec.Code, rec.Body)
+	}
+
+	rec = serveRequest(router, "PATCH", "/hello", "")
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusMethodNotAllowed || apiErr.Code != "method_not_allowed" {
+		t.Errorf("PATCH /hello = %d %+v, want 405 method_not_allowed", rec.Code, apiErr)
+	}
+	if got := rec.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("Allow = %q, want GET, POST", got)
+	}
+}
+
+func TestRequestInfoJSON(t *testing.T) {
+	info := RequestInfo{
+		DynamicURLParameters: xmlMap{"params": "yoda"},
+		Path:                 "/request-info/yoda",
+		QueryParameters:      xmlMultiMap{"q": {"1", "2"}},
+		HTTPMethod:           "GET",
+		Host:                 "localhost:5000",
+		Headers:              xmlMultiMap{"Accept": {"*/*"}},
+		RemoteAddr:           "127.0.0.1:1234",
+		Cookies:              xmlMap{"session": "abc"},
+		ContentLength:        0,
+		Protocol:             "HTTP/1.1",
+		TLS:                  true,
+	}
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(encoded, &fields)
+	want := []string{"dynamic_url_parameters", "path", "query_parameters", "http_method", "host", "headers", "remote_addr", "cookies", "content_length", "protocol", "tls"}
+	if len(fields) != len(want) {
+		t.Errorf("got fields %v, want exactly %v", fields, want)
+	}
+	for _, name := range want {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("field %s is missing in %s", name, encoded)
+		}
+	}
+
+	var decoded RequestInfo
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, info) {
+		t.Errorf("round trip gave %+v, want %+v", decoded, info)
+	}
+}
+
+func TestListRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serveRequest(router, "GET", "/routes", "")
+	var routes []routeInfo
+	decodeData(t, rec, &routes)
+
+	methods := map[string][]string{}
+	for _, route := range routes {
+		methods[route.Path] = route.Methods
+	}
+	want := map[string][]string{
+		"/v1/hello":  {"GET", "POST"},
+		"/hello":     {"GET", "POST"},
+		"/v1/system": {"GET"},
+		"/routes":    {"GET"},
+	}
+	for path, wantMethods := range want {
+		if got, ok := methods[path]; !ok || !reflect.DeepEqual(got, wantMethods) {
+			t.Errorf("%s is listed with methods %v (listed: %v), want %v", path, got, ok, wantMethods)
+		}
+	}
+}
+
+func TestRequestInfoCookiesAndQuery(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	req := httptest.NewRequest("GET", "/request-info/yoda?planet=dagobah&planet=endor", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	req.RemoteAddr = "192.0.2.10:4321"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var info RequestInfo
+	decodeData(t, rec, &info)
+	if info.Cookies["session"] != "abc123" {
+		t.Errorf("cookies = %v, want session=abc123", info.Cookies)
+	}
+	if !reflect.DeepEqual(info.QueryParameters["planet"], []string{"dagobah", "endor"}) {
+		t.Errorf("query parameters = %v, want both planets", info.QueryParameters)
+	}
+	if info.DynamicURLParameters["params"] != "yoda" || info.RemoteAddr != "192.0.2.10:4321" || info.TLS {
+		t.Errorf("got params %v, remote address %q and TLS %v", info.DynamicURLParameters, info.RemoteAddr, info.TLS)
+	}
+}
+
+func TestPrintRoutePattern(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	rec := serveRequest(router, "GET", "/print/Hello_there-General%20Kenobi", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "Hello_there-General Kenobi" {
+		t.Errorf("GET /print with a valid value = %d %q", rec.Code, rec.Body)
+	}
+
+	// Anything outside [A-Za-z0-9 _-] and the control characters doesn't match the route
+	for _, target := range []string{"/print/a%2Fb", "/print/a/b", "/print/%3Cscript%3E", "/print/%C3%85se"} {
+		if rec := serveRequest(router, "GET", target, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+	}
+}
+
+func TestVersionedAndDeprecatedRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	v1 := serveRequest(router, "GET", "/v1/system", "")
+	legacy := serveRequest(router, "GET", "/system", "")
+	if v1.Code != http.StatusOK || legacy.Code != http.StatusOK {
+		t.Fatalf("GET /v1/system = %d and GET /system = %d, want 200 for both", v1.Code, legacy.Code)
+	}
+
+	// Only the unversioned alias tells clients to move on
+	if got := v1.Header().Get("Deprecation"); got != "" {
+		t.Errorf("GET /v1/system has Deprecation %q, want none", got)
+	}
+	if got := legacy.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("GET /system has Deprecation %q, want true", got)
+	}
+}
+
+func TestEchoBodies(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantType    string
+	}{
+		{name: "json", contentType: "application/json", body: `{"name":"Yoda", "age": 900}`, wantType: "application/json"},
+		{name: "text", contentType: "text/plain; charset=utf-8", body: "do or do not\nthere is no try\n", wantType: "text/plain; charset=utf-8"},
+		{name: "empty", contentType: "application/json", wantType: "application/json"},
+		{name: "no content type", body: "\x00\x01binary", wantType: "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/echo/raw", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("POST /echo/raw = %d, want 200\n%s", rec.Code, rec.Body)
+			}
+
+			// The body comes back byte for byte, with the Content-Type it was sent with
+			if got := rec.Body.String(); got != tt.body {
+				t.Errorf("echoed %q, want %q", got, tt.body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type is %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+
+	// The body is capped by maxBodyBytesMiddleware
+	limited := maxBodyBytesMiddleware(8)(router)
+	if rec := serveRequest(limited, "POST", "/echo/raw", "more than eight bytes"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /echo/raw over the limit = %d, want 413", rec.Code)
+	}
+}
+
+func TestHelloWithAndWithoutVersion(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, method := range []string{"GET", "POST"} {
+		body := ""
+		if method == "POST" {
+			body = `{"name": "Yoda"}`
+		}
+		v1 := serveRequest(router, method, "/v1/hello", body)
+		legacy := serveRequest(router, method, "/hello", body)
+
+		// Both paths are registered by registerV1Routes, so they answer the same
+		if v1.Code != legacy.Code || v1.Body.String() != legacy.Body.String() {
+			t.Errorf("%s /v1/hello = %d %q, but %s /hello = %d %q", method, v1.Code, v1.Body, method, legacy.Code, legacy.Body)
+		}
+		if v1.Code != http.StatusOK {
+			t.Errorf("%s /v1/hello = %d, want 200", method, v1.Code)
+		}
+	}
+}
+
+func TestEchoReflectsRequest(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		method   string
+		body     string
+		wantBody interface{}
+	}{
+		{method: "GET", wantBody: nil},
+		{method: "POST", body: `{"jedi": ["Yoda", "Luke"]}`, wantBody: map[string]interface{}{"jedi": []interface{}{"Yoda", "Luke"}}},
+		{method: "POST", body: "not { json", wantBody: "not { json"},
+		{method: "DELETE", wantBody: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.body, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/echo?planet=dagobah&planet=endor", strings.NewReader(tt.body))
+			req.Header.Set("X-Custom", "yes")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s /echo = %d, want 200", tt.method, rec.Code)
+			}
+
+			var info struct {
+				HTTPMethod      string              `json:"http_method"`
+				Path            string              `json:"path"`
+				QueryParameters map[string][]string `json:"query_parameters"`
+				Headers         map[string][]string `json:"headers"`
+				Body            interface{}         `json:"body"`
+			}
+			decodeData(t, rec, &info)
+
+			if info.HTTPMethod != tt.method || info.Path != "/echo" {
+				t.Errorf("echoed %s %s, want %s /echo", info.HTTPMethod, info.Path, tt.method)
+			}
+			if !reflect.DeepEqual(info.QueryParameters["planet"], []string{"dagobah", "endor"}) {
+				t.Errorf("echoed query %v", info.QueryParameters)
+			}
+			if !reflect.DeepEqual(info.Headers["X-Custom"], []string{"yes"}) {
+				t.Errorf("echoed headers %v, want X-Custom", info.Headers)
+			}
+			if !reflect.DeepEqual(info.Body, tt.wantBody) {
+				t.Errorf("echoed body %#v, want %#v", info.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPrintLengthAndCharacters(t *testing.T) {
+	shared := testServices(t)
+	shared.maxPrintBytes = 10
+	router := newV1Router(t, shared)
+
+	rec := serveRequest(router, "GET", "/print/0123456789", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("GET /print with 10 bytes = %d %q, want 200", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/plain; charset=utf-8", got)
+	}
+
+	rec = serveRequest(router, "GET", "/print/0123456789a", "")
+	if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "text_too_long" {
+		t.Errorf("GET /print with 11 bytes = %d %s, want 400 text_too_long", rec.Code, rec.Body)
+	}
+
+	// Whitespace is printed, other control characters are refused
+	for value, want := range map[string]string{"tab%09": "tab\t", "two%0Alines": "two\nlines", "cr%0D": "cr\r"} {
+		if rec := serveRequest(router, "GET", "/print/"+value, ""); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET /print/%s = %d %q, want 200 %q", value, rec.Code, rec.Body, want)
+		}
+	}
+	for _, value := range []string{"a%01b", "a%00b", "a%07b", "a%1Bb", "del%7F"} {
+		rec := serveRequest(router, "GET", "/print/"+value, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_characters" {
+			t.Errorf("GET /print/%s = %d %s, want 400 invalid_characters", value, rec.Code, rec.Body)
+		}
+	}
+
+	t.Setenv("MAX_PRINT_BYTES", "")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxPrintBytes != 4096 {
+		t.Errorf("MaxPrintBytes defaults to %d, want 4096", cfg.MaxPrintBytes)
+	}
+}
+
+func TestWhoami(t *testing.T) {
+	trustProxy = true
+	t.Cleanup(func() { trustProxy = false })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantIP     string
+		wantVia    string
+	}{
+		{name: "remote address", remoteAddr: "192.0.2.1:1234", wantIP: "192.0.2.1", wantVia: "remote_addr"},
+		{name: "IPv6 remote address", remoteAddr: "[2001:db8::1]:1234", wantIP: "2001:db8::1", wantVia: "remote_addr"},
+		{name: "malformed remote address", remoteAddr: "not an address", wantIP: "not an address", wantVia: "remote_addr"},
+		{
+			name:       "first hop of X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.5, 10.0.0.2", "X-Real-IP": "198.51.100.9"},
+			wantIP:     "203.0.113.5",
+			wantVia:    "x-forwarded-for",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.9"},
+			wantIP:     "198.51.100.9",
+			wantVia:    "x-real-ip",
+		},
+		{
+			name:       "empty X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": " , 10.0.0.2"},
+			wantIP:     "10.0.0.1",
+			wantVia:    "remote_addr",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/whoami", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			whoami(rec, req)
+
+			var got map[string]string
+			decodeData(t, rec, &got)
+			if rec.Code != http.StatusOK || got["ip"] != tt.wantIP || got["via"] != tt.wantVia {
+				t.Errorf("GET /whoami = %d %v, want ip %q via %q", rec.Code, got, tt.wantIP, tt.wantVia)
+			}
+		})
+	}
+
+	// Without TRUST_PROXY the headers could be made up by the client, so they are ignored
+	trustProxy = false
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+	rec := httptest.NewRecorder()
+	whoami(rec, req)
+	var got map[string]string
+	decodeData(t, rec, &got)
+	if got["ip"] != "192.0.2.1" || got["via"] != "remote_addr" {
+		t.Errorf("GET /whoami without TRUST_PROXY = %v, want the remote address", got)
+	}
+}
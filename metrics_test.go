@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the text /metrics serves for m.
+func scrape(t *testing.T, m *metrics) string {
+	t.Helper()
+	rec := serveRequest(m.handler(), "GET", "/metrics", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want 200", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsMiddlewareCountsRequests(t *testing.T) {
+	shared := testServices(t)
+	router, err := buildRouter(defaultConfig(), shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := shared.metrics.middleware(router)(router)
+
+	counter := `http_requests_total{method="GET",path="/v1/hello",status="200"}`
+	if strings.Contains(scrape(t, shared.metrics), counter) {
+		t.Fatalf("%s exists before any request", counter)
+	}
+
+	serveRequest(h, "GET", "/v1/hello", "")
+	serveRequest(h, "GET", "/v1/hello", "")
+	serveRequest(h, "GET", "/v1/nope/123", "")
+
+	body := scrape(t, shared.metrics)
+	if !strings.Contains(body, counter+" 2") {
+		t.Errorf("the scrape has no %s 2:\n%s", counter, body)
+	}
+
+	// The route template is the label, so unknown paths all share one
+	if !strings.Contains(body, `http_requests_total{method="GET",path="unmatched",status="404"} 1`) {
+		t.Errorf("the scrape doesn't count the 404 as unmatched")
+	}
+	if !strings.Contains(body, `http_request_duration_seconds_count{method="GET",path="/v1/hello"} 2`) {
+		t.Errorf("the scrape has no duration histogram for /v1/hello")
+	}
+}
+
+func TestMetricsEndpoints(t *testing.T) {
+	shared := testServices(t)
+	router, err := buildRouter(defaultConfig(), shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHandler(defaultConfig(), router, shared)
+
+	// A dynamic parameter shows up as its template, not as the value
+	serveRequest(h, "GET", "/v1/print/yoda", "")
+	serveRequest(h, "GET", "/v1/print/luke", "")
+
+	rec := serveRequest(h, "GET", "/metrics", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want 200", rec.Code)
+	}
+	counter := `http_requests_total{method="GET",path="/v1/print/{what_to_print:[A-Za-z0-9 _[:cntrl:]-]+}",status="200"} 2`
+	if !strings.Contains(rec.Body.String(), counter) {
+		t.Errorf("GET /metrics has no %s", counter)
+	}
+	if strings.Contains(rec.Body.String(), "/v1/print/yoda") {
+		t.Error("GET /metrics has a label with the raw path")
+	}
+	if !strings.Contains(rec.Body.String(), "go_goroutines") {
+		t.Error("GET /metrics has no Go runtime metrics")
+	}
+
+	// /admin/metrics is the same, but needs the admin password
+	if rec := serveRequest(h, "GET", "/admin/metrics", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/metrics without a password = %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/admin/metrics", nil)
+	req.SetBasicAuth("admin", "secret")
+	admin := httptest.NewRecorder()
+	h.ServeHTTP(admin, req)
+	if admin.Code != http.StatusOK || !strings.Contains(admin.Body.String(), counter) {
+		t.Errorf("GET /admin/metrics = %d without %s", admin.Code, counter)
+	}
+}
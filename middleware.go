@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// A middleware is a function that takes a http.Handler and returns a new
+// http.Handler wrapping it. This lets us run code before and after every
+// request without changing the handlers themselves.
+
+// chain wraps h in the middleware mws. The first middleware is the outermost
+// one: chain(h, a, b) is the same as a(b(h)), so a runs before b on the way
+// in and after b on the way out.
+func chain(h http.Handler, mws ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+const requestIDKey contextKey = "request_id"
+
+// maxRequestIDLength is the longest X-Request-ID accepted from a client, so a
+// client can't fill the logs with huge IDs.
+const maxRequestIDLength = 128
+
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/*
+			A request ID connects the log lines of a request to the response the
+			client got. If the client (or a proxy in front of us) already sent one
+			it is kept, so the same ID can be followed through several services.
+		*/
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newUUID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext returns the ID requestIDMiddleware stored in ctx, or ""
+// if there is none.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/*
+			A deferred function runs when the surrounding function returns, also when
+			it returns because of a panic. Calling recover inside it stops the panic,
+			so a bug in one handler doesn't crash the whole server.
+		*/
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// A panic passed on by timeoutMiddleware brings the stack of the handler with it
+			stack := debug.Stack()
+			if p, ok := rec.(handlerPanic); ok {
+				rec, stack = p.val, p.stack
+			}
+
+			// http.ErrAbortHandler is used on purpose to abort a response, so let it through
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			logger.Error("panic while handling request",
+				"request_id", requestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(rec),
+				"stack", string(stack),
+			)
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// http.ResponseWriter doesn't let us read back the status code a handler wrote,
+// so responseWriter wraps it and remembers the code passed to WriteHeader.
+// Because the interface is embedded, every other method is passed straight through.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends what has been written so far to the client, which streaming
+// handlers need. An embedded interface only brings the methods of the
+// interface itself, so Flush has to be passed on by hand.
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over to the handler, which WebSockets need.
+// The handler then answers with 101 Switching Protocols itself.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter. http.ResponseController uses it
+// to reach methods like SetWriteDeadline that the wrapper doesn't have.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		/*
+			A handler that never calls WriteHeader implicitly sends 200 OK,
+			so that's what the status starts out as.
+		*/
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		// Each value gets its own field in the JSON record, so logs can be searched by them
+		logger.Info("request",
+			"request_id", requestIDFromContext(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rw.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
+func securityHeadersMiddleware(contentSecurityPolicy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			/*
+				These headers tell browsers to be stricter with the responses:
+				nosniff stops them from guessing a different type than the
+				Content-Type, DENY stops other sites from showing the pages in a
+				frame, no-referrer keeps the url out of requests to other sites,
+				and the Content-Security-Policy limits where a page may load
+				scripts, styles and images from.
+			*/
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			h.Set("Content-Security-Policy", contentSecurityPolicy)
+
+			/*
+				Strict-Transport-Security makes browsers use HTTPS for the next two
+				years, even when a link says http://. It is only sent over HTTPS,
+				since a server that can't speak HTTPS would become unreachable.
+			*/
+			if r.TLS != nil {
+				h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	/*
+		The allowed origins are turned into a map once, so looking up the
+		origin of each request is quick. "*" means any origin is allowed.
+	*/
+	allowAll := false
+	allowed := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			/*
+				Browsers only let a web page read the response from another origin
+				if the Access-Control-Allow-Origin header allows it. With a specific
+				list of origins we echo back the request's Origin when it's on the
+				list, and the Vary header tells caches the response depends on it.
+			*/
+			origin := r.Header.Get("Origin")
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Add("Vary", "Origin")
+				if allowed[origin] {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-None-Match")
+
+			// Scripts in the browser can only read the response headers that are listed here
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag")
+
+			/*
+				Before some requests the browser sends an OPTIONS "preflight" request
+				to ask which methods and headers are allowed. The headers above answer
+				that, so it's answered right away with 204 No Content.
+			*/
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// gzipMinSize is the smallest response body worth compressing. For tiny
+// bodies the gzip header and footer would add more bytes than they save.
+const gzipMinSize = 512
+
+// gzipResponseWriter sends what a handler writes through a gzip.Writer, which
+// compresses the data before passing it on to the real ResponseWriter. The
+// first gzipMinSize bytes are held back in buf, so small responses can still
+// be sent as they are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	buf     []byte
+	status  int
+	decided bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status != 0 {
+		return
+	}
+	g.status = status
+
+	// Responses with these status codes never have a body, so there's nothing to compress
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		g.decide(false)
+	}
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(b)
+		}
+		return g.ResponseWriter.Write(b)
+	}
+
+	// Until there are gzipMinSize bytes it isn't known yet if compressing is worth it
+	g.buf = append(g.buf, b...)
+	if len(g.buf) >= gzipMinSize {
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (g *gzipResponseWriter) decide(compress bool) error {
+	g.decided = true
+
+	/*
+		When compressing, the Content-Length the handler may have set is removed,
+		because it is the length before compression. A handler that already
+		encoded the body itself (and set Content-Encoding) is left alone.
+	*/
+	if compress && g.Header().Get("Content-Encoding") == "" {
+		g.Header().Set("Content-Encoding", "gzip")
+		g.Header().Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	buffered := g.buf
+	g.buf = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if g.gz != nil {
+		_, err := g.gz.Write(buffered)
+		return err
+	}
+	_, err := g.ResponseWriter.Write(buffered)
+	return err
+}
+
+// Flush sends what has been written so far to the client. A response that is
+// still held back at that point, like a small event of a stream, is sent
+// uncompressed, since it has to go out right away.
+func (g *gzipResponseWriter) Flush() {
+	if g.status == 0 {
+		g.WriteHeader(http.StatusOK)
+	}
+	if !g.decided {
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(g.ResponseWriter).Hijack()
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Close sends what is still held back and writes the end of the compressed
+// data. It must be called when the handler is done.
+func (g *gzipResponseWriter) Close() error {
+	if !g.decided && g.status != 0 {
+		if err := g.decide(false); err != nil {
+			return err
+		}
+	}
+	if g.gz == nil {
+		return nil
+	}
+	return g.gz.Close()
+}
+
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/*
+			The response depends on the Accept-Encoding header, which caches need to
+			know. Clients that don't list gzip in it get the normal response, and so
+			do HEAD requests, which never get a body.
+		*/
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func maxBodyBytesMiddleware(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			/*
+				http.MaxBytesReader stops reading the body after n bytes and returns
+				an *http.MaxBytesError instead, so a client can't make a handler read
+				gigabytes of data into memory. See writeDecodeError for the 413 response.
+			*/
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maxLoggedBodyBytes is how much of a request body bodyLoggingMiddleware
+// writes to the log, so large bodies don't flood it.
+const maxLoggedBodyBytes = 1024
+
+func bodyLoggingMiddleware(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		// Bodies can contain passwords and personal data, so they are only logged when asked for
+		if !enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// ContentLength is 0 for requests without a body, and -1 if the length isn't known
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			/*
+				A body can only be read once, so after reading it here the handler
+				would get nothing. r.Body is replaced with a reader over the bytes
+				that were read, which the handler can read as if it were the
+				original body. This runs after maxBodyBytesMiddleware, so at most
+				MAX_BODY_BYTES are held in memory.
+			*/
+			body, err := io.ReadAll(r.Body)
+			var rest io.Reader = bytes.NewReader(body)
+			if err != nil {
+				// The handler gets the same error, e.g. the 413 for a body that is too large
+				rest = io.MultiReader(rest, errorReader{err})
+			}
+			r.Body = io.NopCloser(rest)
+
+			logged := body[:min(len(body), maxLoggedBodyBytes)]
+			logger.Info("request body",
+				"request_id", requestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"body", string(logged),
+				"body_bytes", len(body),
+				"truncated", len(logged) < len(body),
+			)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errorReader is an io.Reader that always fails with err.
+type errorReader struct {
+	err error
+}
+
+func (e errorReader) Read(p []byte) (int, error) {
+	return 0, e.err
+}
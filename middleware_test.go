@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// panicking is a test endpoint with a bug that makes it panic.
+func panicking(w http.ResponseWriter, r *http.Request) {
+	var m map[string]int
+	m["boom"]++
+}
+
+func TestRecoverMiddlewareAnswers500(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+	router.HandleFunc("/panic", panicking)
+
+	// A real server shows whether the client gets a response or a dropped connection
+	srv := httptest.NewServer(chain(router, recoverMiddleware))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic failed instead of answering: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("the 500 response is not JSON: %v", err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError || body.Error.Code != "internal_error" {
+		t.Errorf("GET /panic = %d %+v, want 500 internal_error", resp.StatusCode, body.Error)
+	}
+
+	// The server is still there for the next request
+	resp, err = http.Get(srv.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /hello after the panic = %d, want 200", resp.StatusCode)
+	}
+}
+
+// captureLogs makes logger write to a buffer until the end of the test, and
+// returns a function that decodes the JSON records written so far.
+func captureLogs(t *testing.T) func() []map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := logger
+	logger = newLogger(&buf, slog.LevelDebug)
+	t.Cleanup(func() { logger = previous })
+
+	return func() []map[string]interface{} {
+		t.Helper()
+		var records []map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		for decoder.More() {
+			var record map[string]interface{}
+			if err := decoder.Decode(&record); err != nil {
+				t.Fatalf("log record is not JSON: %v\n%s", err, buf.String())
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func TestLoggingMiddlewareLogsStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    float64
+	}{
+		{name: "explicit 404", handler: notFound, want: http.StatusNotFound},
+		{name: "no WriteHeader", handler: hello, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			serveRequest(loggingMiddleware(tt.handler), "GET", "/somewhere", "")
+
+			records := logs()
+			if len(records) != 1 {
+				t.Fatalf("got %d log records, want 1", len(records))
+			}
+			if got := records[0]["status"]; got != tt.want {
+				t.Errorf("logged status %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseWriterRecordsStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: rec, status: http.StatusOK}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write([]byte("created"))
+
+	if rw.status != http.StatusCreated {
+		t.Errorf("the wrapper recorded %d, want 201", rw.status)
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" {
+		t.Errorf("the client got %d %q, want the response passed through", rec.Code, rec.Body)
+	}
+
+	// The log line has the method, the path and how long the request took
+	logs := captureLogs(t)
+	serveRequest(loggingMiddleware(http.HandlerFunc(hello)), "PUT", "/hello", "")
+	record := logs()[0]
+	if record["method"] != "PUT" || record["path"] != "/hello" {
+		t.Errorf("logged %v %v, want PUT /hello", record["method"], record["path"])
+	}
+	if _, ok := record["duration_ms"].(float64); !ok {
+		t.Errorf("duration_ms = %v, want a number", record["duration_ms"])
+	}
+}
+
+func TestRecoverMiddlewareLogsPanic(t *testing.T) {
+	logs := captureLogs(t)
+	h := chain(http.HandlerFunc(panicking), requestIDMiddleware, recoverMiddleware)
+
+	rec := serveRequest(h, "GET", "/panic", "")
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /panic = %d %s, want 500 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	records := logs()
+	if len(records) != 1 || records[0]["msg"] != "panic while handling request" {
+		t.Fatalf("got log records %v, want the panic", records)
+	}
+	if records[0]["request_id"] != rec.Header().Get("X-Request-ID") {
+		t.Errorf("the panic was logged with request_id %v, want the one of the response", records[0]["request_id"])
+	}
+	if panicText, _ := records[0]["panic"].(string); !strings.Contains(panicText, "nil map") {
+		t.Errorf("logged panic %q, want the panic of the handler", panicText)
+	}
+}
+
+func TestRecoverMiddlewareLetsAbortThrough(t *testing.T) {
+	abort := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to be passed on", rec)
+		}
+	}()
+	serveRequest(recoverMiddleware(abort), "GET", "/", "")
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		wantOrigin string
+		wantCode   int
+	}{
+		{name: "any origin", allowed: []string{"*"}, method: "GET", origin: "http://a.example", wantOrigin: "*", wantCode: http.StatusOK},
+		{name: "allowed origin", allowed: []string{"http://a.example"}, method: "GET", origin: "http://a.example", wantOrigin: "http://a.example", wantCode: http.StatusOK},
+		{name: "disallowed origin", allowed: []string{"http://a.example"}, method: "GET", origin: "http://b.example", wantOrigin: "", wantCode: http.StatusOK},
+		{name: "preflight", allowed: []string{"http://a.example"}, method: "OPTIONS", origin: "http://a.example", wantOrigin: "http://a.example", wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/hello", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			corsMiddleware(tt.allowed)(http.HandlerFunc(hello)).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.method == "OPTIONS" {
+				if rec.Body.Len() != 0 || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+					t.Errorf("preflight got body %q and methods %q, want no body and the allowed methods", rec.Body, rec.Header().Get("Access-Control-Allow-Methods"))
+				}
+			}
+		})
+	}
+}
+
+func TestCORSOriginsFromEnvironment(t *testing.T) {
+	t.Setenv("CORS_ORIGINS", "http://localhost:3000, https://example.com")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := corsMiddleware(cfg.CORSOrigins)(newV1Router(t, testServices(t)))
+
+	send := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/hello", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if got := send("GET", "https://example.com").Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("matching origin got Access-Control-Allow-Origin %q", got)
+	}
+
+	rec := send("GET", "https://evil.example")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("non-matching origin got Access-Control-Allow-Origin %q, want none", got)
+	}
+	if rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("Vary = %q, want Origin", rec.Header().Get("Vary"))
+	}
+
+	// The router has no OPTIONS route, the middleware answers the preflight itself
+	rec = send("OPTIONS", "http://localhost:3000")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("preflight = %d with origin %q, want 204 allowing it", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	// The body has to be larger than gzipMinSize to be compressed
+	payload := map[string]string{"text": strings.Repeat("Do or do not, there is no try. ", 50)}
+	h := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSuccess(w, r, http.StatusOK, payload)
+	}))
+	want, _ := json.Marshal(APIResponse{Data: payload})
+
+	t.Run("with Accept-Encoding", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+		}
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bytes.TrimSpace(got)) != string(want) {
+			t.Errorf("decompressed to %s, want %s", got, want)
+		}
+	})
+
+	t.Run("without Accept-Encoding", func(t *testing.T) {
+		rec := serveRequest(h, "GET", "/", "")
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Content-Encoding = %q, want none", rec.Header().Get("Content-Encoding"))
+		}
+		if got := bytes.TrimSpace(rec.Body.Bytes()); string(got) != string(want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+}
+
+func TestMaxBodyBytesMiddleware(t *testing.T) {
+	h := maxBodyBytesMiddleware(16)(http.HandlerFunc(postHello))
+
+	rec := serveRequest(h, "POST", "/hello", `{"name": "`+strings.Repeat("a", 100)+`"}`)
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusRequestEntityTooLarge || apiErr.Code != "body_too_large" {
+		t.Errorf("oversized body = %d %+v, want 413 body_too_large", rec.Code, apiErr)
+	}
+
+	if rec := serveRequest(h, "POST", "/hello", `{"name": "Yoda"}`); rec.Code != http.StatusOK {
+		t.Errorf("small body = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+}
+
+func TestGzipMiddlewareWithRouter(t *testing.T) {
+	h := chain(newV1Router(t, testServices(t)), gzipMiddleware)
+
+	req := httptest.NewRequest("GET", "/uuid?count=50", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("got Content-Encoding %q and Vary %q, want gzip varying by Accept-Encoding", rec.Header().Get("Content-Encoding"), rec.Header().Get("Vary"))
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Data struct {
+			UUIDs []string `json:"uuids"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(gz).Decode(&resp); err != nil {
+		t.Fatalf("the decompressed body is not JSON: %v", err)
+	}
+	if len(resp.Data.UUIDs) != 50 {
+		t.Errorf("got %d UUIDs, want 50", len(resp.Data.UUIDs))
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" in")
+				next.ServeHTTP(w, r)
+				calls = append(calls, name+" out")
+			})
+		}
+	}
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), record("a"), record("b"), record("c"))
+
+	serveRequest(h, "GET", "/", "")
+
+	// The first middleware is the outermost one
+	want := []string{"a in", "b in", "c in", "handler", "c out", "b out", "a out"}
+	if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got calls %v, want %v", calls, want)
+	}
+}
+
+func TestNewHandlerLogsAndCountsPanics(t *testing.T) {
+	shared := testServices(t)
+	router, err := buildRouter(defaultConfig(), shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.HandleFunc("/panic", panicking)
+	logs := captureLogs(t)
+
+	rec := serveRequest(newHandler(defaultConfig(), router, shared), "GET", "/panic", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("GET /panic = %d, want 500", rec.Code)
+	}
+
+	// The 500 from recoverMiddleware is what loggingMiddleware sees
+	var logged bool
+	for _, record := range logs() {
+		if record["msg"] == "request" {
+			logged = true
+			if record["status"] != float64(http.StatusInternalServerError) {
+				t.Errorf("the request was logged with status %v, want 500", record["status"])
+			}
+		}
+	}
+	if !logged {
+		t.Error("the request wasn't logged")
+	}
+
+	counter := `http_requests_total{method="GET",path="/panic",status="500"} 1`
+	if body := scrape(t, shared.metrics); !strings.Contains(body, counter) {
+		t.Errorf("the scrape has no %s", counter)
+	}
+}
+
+func TestMaxBodyBytesFromEnvironment(t *testing.T) {
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxBodyBytes != 1<<20 {
+		t.Errorf("MaxBodyBytes defaults to %d, want 1 MiB", cfg.MaxBodyBytes)
+	}
+
+	body := `{"name": "Yoda"}`
+	t.Setenv("MAX_BODY_BYTES", fmt.Sprint(len(body)))
+	if cfg, err = resolveConfig(flags{}); err != nil {
+		t.Fatal(err)
+	}
+	shared := testServices(t)
+	router, err := buildRouter(cfg, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHandler(cfg, router, shared)
+
+	// A body of exactly the limit is fine, one byte more is not
+	if rec := serveRequest(h, "POST", "/v1/hello", body); rec.Code != http.StatusOK {
+		t.Errorf("a body at the limit = %d, want 200\n%s", rec.Code, rec.Body)
+	}
+	rec := serveRequest(h, "POST", "/v1/hello", `{"name": "Yodaa"}`)
+	if rec.Code != http.StatusRequestEntityTooLarge || decodeError(t, rec).Code != "body_too_large" {
+		t.Errorf("a body one byte over the limit = %d, want 413 body_too_large\n%s", rec.Code, rec.Body)
+	}
+
+	t.Setenv("MAX_BODY_BYTES", "big")
+	if _, err := resolveConfig(flags{}); err == nil {
+		t.Error("MAX_BODY_BYTES=big gave no error")
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := requestIDMiddleware(loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	})))
+
+	t.Run("inbound", func(t *testing.T) {
+		logs := captureLogs(t)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Request-ID"); got != "abc-123" || seen != "abc-123" {
+			t.Errorf("got header %q and context %q, want the inbound abc-123", got, seen)
+		}
+		if records := logs(); len(records) != 1 || records[0]["request_id"] != "abc-123" {
+			t.Errorf("got log records %v, want one with request_id abc-123", records)
+		}
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		rec := serveRequest(h, "GET", "/", "")
+		got := rec.Header().Get("X-Request-ID")
+		if !uuidPattern.MatchString(got) || seen != got {
+			t.Errorf("got header %q and context %q, want the same new UUID", got, seen)
+		}
+
+		// Every request gets its own
+		if next := serveRequest(h, "GET", "/", "").Header().Get("X-Request-ID"); next == got {
+			t.Errorf("two requests both got ID %q", got)
+		}
+	})
+
+	if id := requestIDFromContext(httptest.NewRequest("GET", "/", nil).Context()); id != "" {
+		t.Errorf("a context without an ID gave %q", id)
+	}
+}
+
+func TestRequestIDThroughHandler(t *testing.T) {
+	shared := testServices(t)
+	router, err := buildRouter(defaultConfig(), shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHandler(defaultConfig(), router, shared)
+
+	tests := []struct {
+		name    string
+		inbound string
+		keep    bool
+	}{
+		{name: "provided", inbound: "trace-42", keep: true},
+		{name: "absent"},
+		{name: "too long", inbound: strings.Repeat("x", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/hello", nil)
+			if tt.inbound != "" {
+				req.Header.Set("X-Request-ID", tt.inbound)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("X-Request-ID")
+			if tt.keep && got != tt.inbound {
+				t.Errorf("X-Request-ID = %q, want the inbound %q", got, tt.inbound)
+			}
+			if !tt.keep && !uuidPattern.MatchString(got) {
+				t.Errorf("X-Request-ID = %q, want a new UUID", got)
+			}
+		})
+	}
+
+	// Responses that don't reach a handler have one too
+	if rec := serveRequest(h, "GET", "/nope", ""); rec.Header().Get("X-Request-ID") == "" {
+		t.Error("the 404 has no X-Request-ID")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	// The headers come from the whole chain, also on errors like a 404
+	cfg := defaultConfig()
+	shared := testServices(t)
+	router, err := buildRouter(cfg, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHandler(cfg, router, shared)
+
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": defaultContentSecurityPolicy,
+	}
+	for _, target := range []string{"/health", "/nope"} {
+		rec := serveRequest(h, "GET", target, "")
+		for name, value := range want {
+			if got := rec.Header().Get(name); got != value {
+				t.Errorf("GET %s has %s %q, want %q", target, name, got, value)
+			}
+		}
+		if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("GET %s over plain HTTP has Strict-Transport-Security %q", target, got)
+		}
+	}
+
+	// HSTS is only sent over TLS
+	req := httptest.NewRequest("GET", "https://localhost/health", nil)
+	if req.TLS == nil {
+		t.Fatal("the test request has no TLS state")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=63072000; includeSubDomains" {
+		t.Errorf("GET over TLS has Strict-Transport-Security %q", got)
+	}
+}
+
+func TestContentSecurityPolicyFromEnvironment(t *testing.T) {
+	t.Setenv("CONTENT_SECURITY_POLICY", "default-src 'none'")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveRequest(securityHeadersMiddleware(cfg.ContentSecurityPolicy)(http.HandlerFunc(hello)), "GET", "/hello", "")
+	if got := rec.Header().Get("Content-Security-Policy"); got != "default-src 'none'" {
+		t.Errorf("Content-Security-Policy is %q, want the one from CONTENT_SECURITY_POLICY", got)
+	}
+}
+
+func TestBodyLoggingKeepsBody(t *testing.T) {
+	logs := captureLogs(t)
+	h := bodyLoggingMiddleware(true)(http.HandlerFunc(postHello))
+
+	// postHello still decodes the body after it was logged
+	rec := serveRequest(h, "POST", "/v1/hello", `{"name": "Yoda"}`)
+	var data struct {
+		Greeting string `json:"greeting"`
+	}
+	decodeData(t, rec, &data)
+	if rec.Code != http.StatusOK || data.Greeting != "Hello, Yoda!" {
+		t.Fatalf("POST /v1/hello = %d %+v, want the greeting of postHello", rec.Code, data)
+	}
+
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want the body", len(records))
+	}
+	want := map[string]interface{}{
+		"msg":        "request body",
+		"method":     "POST",
+		"path":       "/v1/hello",
+		"body":       `{"name": "Yoda"}`,
+		"body_bytes": float64(len(`{"name": "Yoda"}`)),
+		"truncated":  false,
+	}
+	for field, value := range want {
+		if records[0][field] != value {
+			t.Errorf("logged %s %v, want %v", field, records[0][field], value)
+		}
+	}
+}
+
+func TestBodyLoggingTruncates(t *testing.T) {
+	logs := captureLogs(t)
+	var got []byte
+	h := bodyLoggingMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+	}))
+
+	// Only the start of a long body is logged, but the handler gets all of it
+	body := strings.Repeat("a", maxLoggedBodyBytes+100)
+	serveRequest(h, "POST", "/echo", body)
+	if string(got) != body {
+		t.Errorf("the handler read %d bytes, want %d", len(got), len(body))
+	}
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want the body", len(records))
+	}
+	if logged, _ := records[0]["body"].(string); len(logged) != maxLoggedBodyBytes || records[0]["truncated"] != true {
+		t.Errorf("logged %d bytes with truncated %v, want %d and true", len(logged), records[0]["truncated"], maxLoggedBodyBytes)
+	}
+}
+
+func TestBodyLoggingRespectsLimit(t *testing.T) {
+	logs := captureLogs(t)
+	h := maxBodyBytesMiddleware(16)(bodyLoggingMiddleware(true)(http.HandlerFunc(postHello)))
+
+	// The body is read only up to the limit, and the handler still answers 413
+	rec := serveRequest(h, "POST", "/v1/hello", `{"name": "`+strings.Repeat("a", 100)+`"}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("too large body = %d, want 413\n%s", rec.Code, rec.Body)
+	}
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want the body", len(records))
+	}
+	if n, _ := records[0]["body_bytes"].(float64); n > 16 {
+		t.Errorf("read %v bytes of the body, want at most the limit of 16", n)
+	}
+}
+
+func TestBodyLoggingDisabled(t *testing.T) {
+	logs := captureLogs(t)
+	rec := serveRequest(bodyLoggingMiddleware(false)(http.HandlerFunc(postHello)), "POST", "/v1/hello", `{"name": "Yoda"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /v1/hello = %d, want 200", rec.Code)
+	}
+	if records := logs(); len(records) != 0 {
+		t.Errorf("logged %v without LOG_BODIES", records)
+	}
+}
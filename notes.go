@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// note is a short piece of text stored by the /notes endpoints.
+type note struct {
+	ID        int       `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// noteStore keeps notes in memory, guarded by a sync.RWMutex like the
+// key-value store. Every new note gets the next number from nextID, so
+// IDs are never reused, even after a note is deleted.
+type noteStore struct {
+	mu     sync.RWMutex
+	notes  map[int]note
+	nextID int
+}
+
+func newNoteStore() *noteStore {
+	return &noteStore{notes: map[int]note{}, nextID: 1}
+}
+
+// len returns the number of notes in the store.
+func (s *noteStore) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.notes)
+}
+
+// noteInput is the JSON body accepted when creating or updating a note.
+type noteInput struct {
+	Body string `json:"body"`
+}
+
+func (s *noteStore) create(w http.ResponseWriter, r *http.Request) {
+	var input noteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	s.mu.Lock()
+	n := note{ID: s.nextID, Body: input.Body, CreatedAt: time.Now().UTC()}
+	s.notes[n.ID] = n
+	s.nextID++
+	s.mu.Unlock()
+
+	writeSuccess(w, r, http.StatusCreated, n)
+}
+
+func (s *noteStore) list(w http.ResponseWriter, r *http.Request) {
+	/*
+		The list is sent in pages like /todos. ?sort=id or ?sort=created_at
+		with ?order=asc or ?order=desc choose the order, and ?q= only keeps the
+		notes whose body contains that text.
+	*/
+	limit, offset, err := pageQuery(r)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+	field, desc, err := sortQuery(r, "id", "created_at")
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	// strings.ToLower on both sides makes the search ignore upper and lower case
+	q := strings.ToLower(r.URL.Query().Get("q"))
+
+	s.mu.RLock()
+	notes := make([]note, 0, len(s.notes))
+	for _, n := range s.notes {
+		if strings.Contains(strings.ToLower(n.Body), q) {
+			notes = append(notes, n)
+		}
+	}
+	s.mu.RUnlock()
+
+	/*
+		Maps have no order in Go, so the notes are always sorted. Notes created
+		at the same moment are sorted by ID, so the order never changes between
+		two requests, which paging through the list depends on.
+	*/
+	sort.Slice(notes, func(i, j int) bool {
+		a, b := notes[i], notes[j]
+		if desc {
+			a, b = b, a
+		}
+		if field == "created_at" && !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	start, end := pageBounds(len(notes), limit, offset)
+
+	/*
+		total, limit and offset go under "meta" like in every other list, not
+		next to "data", so a client reads the pages of /notes and /todos the
+		same way.
+	*/
+	writeJSON(w, r, http.StatusOK, APIResponse{
+		Data: notes[start:end],
+		Meta: page{Total: len(notes), Limit: limit, Offset: offset},
+	})
+}
+
+func (s *noteStore) get(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s.mu.RLock()
+	n, exists := s.notes[id]
+	s.mu.RUnlock()
+
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "note_not_found", "note not found")
+		return
+	}
+	writeSuccess(w, r, http.StatusOK, n)
+}
+
+func (s *noteStore) update(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var input noteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, exists := s.notes[id]
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "note_not_found", "note not found")
+		return
+	}
+	n.Body = input.Body
+	s.notes[id] = n
+
+	writeSuccess(w, r, http.StatusOK, n)
+}
+
+func (s *noteStore) delete(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.notes[id]; !exists {
+		writeAPIError(w, r, http.StatusNotFound, "note_not_found", "note not found")
+		return
+	}
+	delete(s.notes, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
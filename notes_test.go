@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNoteLifecycle(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	rec := serveRequest(router, "POST", "/notes", `{"body": "Do or do not"}`)
+	var created note
+	decodeData(t, rec, &created)
+	if rec.Code != http.StatusCreated || created.ID != 1 || created.Body != "Do or do not" || created.CreatedAt.IsZero() {
+		t.Fatalf("POST /notes = %d %+v, want 201 with note 1", rec.Code, created)
+	}
+
+	rec = serveRequest(router, "GET", "/notes/1", "")
+	var got note
+	decodeData(t, rec, &got)
+	if rec.Code != http.StatusOK || got != created {
+		t.Errorf("GET /notes/1 = %d %+v, want %+v", rec.Code, got, created)
+	}
+
+	rec = serveRequest(router, "PUT", "/notes/1", `{"body": "There is no try"}`)
+	decodeData(t, rec, &got)
+	if rec.Code != http.StatusOK || got.Body != "There is no try" || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("PUT /notes/1 = %d %+v, want the new body with the same created_at", rec.Code, got)
+	}
+
+	if rec := serveRequest(router, "DELETE", "/notes/1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /notes/1 = %d, want 204", rec.Code)
+	}
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if rec := serveRequest(router, method, "/notes/1", `{"body": "x"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("%s /notes/1 after the delete = %d, want 404", method, rec.Code)
+		}
+	}
+
+	// IDs are never reused, also not after a delete
+	rec = serveRequest(router, "POST", "/notes", `{"body": "again"}`)
+	decodeData(t, rec, &created)
+	if created.ID != 2 {
+		t.Errorf("the note after the delete got ID %d, want 2", created.ID)
+	}
+}
+
+func TestNoteConcurrentCreates(t *testing.T) {
+	notes := newNoteStore()
+	const n = 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			serveRequest(http.HandlerFunc(notes.create), "POST", "/notes", fmt.Sprintf(`{"body": "note %d"}`, i))
+		}(i)
+	}
+	wg.Wait()
+
+	// Every note got its own ID, from 1 to n
+	if notes.len() != n {
+		t.Fatalf("the store has %d notes, want %d", notes.len(), n)
+	}
+	for id := 1; id <= n; id++ {
+		if _, exists := notes.notes[id]; !exists {
+			t.Errorf("there is no note with ID %d", id)
+		}
+	}
+}
+
+func TestNoteListQuery(t *testing.T) {
+	// The notes were created in another order than their IDs, so the two sorts differ
+	start := time.Date(2024, 5, 4, 12, 0, 0, 0, time.UTC)
+	notes := newNoteStore()
+	for id, body := range []string{"Do or do not", "There is no try", "Luminous beings are we", "Size matters not", "Do not underestimate"} {
+		notes.notes[id+1] = note{ID: id + 1, Body: body, CreatedAt: start.Add(time.Duration(5-id) * time.Minute)}
+	}
+	notes.nextID = 6
+	list := http.HandlerFunc(notes.list)
+
+	tests := []struct {
+		query     string
+		wantIDs   []int
+		wantTotal int
+		wantLimit int
+		wantOff   int
+	}{
+		{query: "", wantIDs: []int{1, 2, 3, 4, 5}, wantTotal: 5, wantLimit: defaultPageLimit},
+		{query: "?limit=2", wantIDs: []int{1, 2}, wantTotal: 5, wantLimit: 2},
+		{query: "?limit=2&offset=4", wantIDs: []int{5}, wantTotal: 5, wantLimit: 2, wantOff: 4},
+		{query: "?offset=5", wantIDs: []int{}, wantTotal: 5, wantLimit: defaultPageLimit, wantOff: 5},
+		{query: "?limit=100", wantIDs: []int{1, 2, 3, 4, 5}, wantTotal: 5, wantLimit: maxPageLimit},
+		{query: "?sort=id&order=desc", wantIDs: []int{5, 4, 3, 2, 1}, wantTotal: 5, wantLimit: defaultPageLimit},
+		{query: "?sort=created_at", wantIDs: []int{5, 4, 3, 2, 1}, wantTotal: 5, wantLimit: defaultPageLimit},
+		{query: "?sort=created_at&order=desc", wantIDs: []int{1, 2, 3, 4, 5}, wantTotal: 5, wantLimit: defaultPageLimit},
+		{query: "?q=not", wantIDs: []int{1, 4, 5}, wantTotal: 3, wantLimit: defaultPageLimit},
+		{query: "?q=DO", wantIDs: []int{1, 5}, wantTotal: 2, wantLimit: defaultPageLimit},
+		{query: "?q=not&sort=created_at&limit=2", wantIDs: []int{5, 4}, wantTotal: 3, wantLimit: 2},
+		{query: "?q=vader", wantIDs: []int{}, wantTotal: 0, wantLimit: defaultPageLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serveRequest(list, "GET", "/notes"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /notes%s = %d, want 200\n%s", tt.query, rec.Code, rec.Body)
+			}
+
+			// The paging is under meta, like in every list of the API
+			var body struct {
+				Data []note `json:"data"`
+				Meta page   `json:"meta"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("could not decode %s: %v", rec.Body, err)
+			}
+			if want := (page{Total: tt.wantTotal, Limit: tt.wantLimit, Offset: tt.wantOff}); body.Meta != want {
+				t.Errorf("meta = %+v, want %+v", body.Meta, want)
+			}
+			got := []int{}
+			for _, n := range body.Data {
+				got = append(got, n.ID)
+			}
+			if !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("got the notes %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?offset=-1", "?sort=body", "?order=up"} {
+		rec := serveRequest(list, "GET", "/notes"+query, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_query" {
+			t.Errorf("GET /notes%s = %d %s, want 400 invalid_query", query, rec.Code, rec.Body)
+		}
+	}
+}
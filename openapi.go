@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// The types below are the parts of an OpenAPI 3.0 document this API needs.
+// OpenAPI is a standard way to describe an API in JSON, which tools use to
+// show documentation or generate client code. The full format is described
+// on https://spec.openapis.org/oas/v3.0.3.
+type openAPIDoc struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	Summary    string                     `json:"summary,omitempty"`
+	Parameters []openAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]openAPIResponse `json:"responses"`
+	Security   []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]interface{} `json:"schemas"`
+	SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+}
+
+// responseTypes lists the operations that don't answer with JSON, by method
+// and path without /v1. Every other operation answers with the APIResponse
+// envelope.
+var responseTypes = map[string]string{
+	"GET /":                      "text/html",
+	"GET /hello":                 "text/plain",
+	"GET /print/{what_to_print}": "text/plain",
+	"GET /system/stream":         "text/event-stream",
+	"GET /events/time":           "text/event-stream",
+	"POST /base64/encode":        "text/plain",
+	"POST /base64/decode":        "application/octet-stream",
+	"GET /download/{name}":       "application/octet-stream",
+	"GET /metrics":               "text/plain",
+	"GET /admin/metrics":         "text/plain",
+	"GET /docs":                  "text/html",
+}
+
+// routeSecurity names the security scheme of the endpoints that need a
+// token or a password, see openAPIComponents.SecuritySchemes.
+var routeSecurity = map[string]string{
+	"/me":            "bearerAuth",
+	"/admin/stats":   "basicAuth",
+	"/admin/routes":  "basicAuth",
+	"/admin/metrics": "basicAuth",
+}
+
+// pathVariable matches a path variable like {id:[0-9]+}, with the name and
+// the optional pattern as submatches.
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(?::([^}]*))?\}`)
+
+func openAPISpec(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Tools expect the document itself, so it isn't wrapped in "data" like other responses
+		writeJSON(w, r, http.StatusOK, buildOpenAPIDoc(router))
+	})
+}
+
+func buildOpenAPIDoc(router *mux.Router) openAPIDoc {
+	doc := openAPIDoc{
+		OpenAPI:    "3.0.3",
+		Info:       openAPIInfo{Title: "Simple REST API in Go", Version: version},
+		Paths:      map[string]map[string]openAPIOperation{},
+		Components: openAPIComponents{Schemas: openAPISchemas, SecuritySchemes: openAPISecuritySchemes},
+	}
+
+	/*
+		The paths come from the router, like /routes, so the document is always
+		in line with what the server really handles. Prefixes like /static/
+		match many paths and aren't a single operation, so they are left out.
+	*/
+	for _, route := range currentRoutes(router) {
+		if route.Path != "/" && strings.HasSuffix(route.Path, "/") {
+			continue
+		}
+
+		// OpenAPI writes path variables without the pattern, e.g. /notes/{id}
+		path := routePattern.ReplaceAllString(route.Path, "")
+		short := strings.TrimPrefix(path, "/v1")
+
+		parameters := []openAPIParameter{}
+		for _, match := range pathVariable.FindAllStringSubmatch(route.Path, -1) {
+			schema := map[string]interface{}{"type": "string"}
+			if match[2] != "" {
+				schema["pattern"] = "^" + match[2] + "$"
+			}
+			parameters = append(parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: schema})
+		}
+
+		// Routes that accept any method are documented with the common ones
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+		}
+
+		operations := map[string]openAPIOperation{}
+		for _, method := range methods {
+			operation := openAPIOperation{
+				Summary:    routeDescriptions[short],
+				Parameters: parameters,
+				Responses: map[string]openAPIResponse{
+					"2XX":     successResponse(responseTypes[method+" "+short]),
+					"default": {Description: "Error", Content: jsonContent(schemaRef("Error"))},
+				},
+			}
+			if scheme, ok := routeSecurity[short]; ok {
+				operation.Security = []map[string][]string{{scheme: {}}}
+			}
+			operations[strings.ToLower(method)] = operation
+		}
+		doc.Paths[path] = operations
+	}
+	return doc
+}
+
+func successResponse(contentType string) openAPIResponse {
+	if contentType == "" {
+		return openAPIResponse{Description: "Success", Content: jsonContent(schemaRef("Success"))}
+	}
+	return openAPIResponse{
+		Description: "Success",
+		Content:     map[string]openAPIMediaType{contentType: {Schema: map[string]interface{}{"type": "string"}}},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISchemas describes the APIResponse and APIError envelopes from
+// response.go, which every JSON response uses.
+var openAPISchemas = map[string]interface{}{
+	"Success": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"data"},
+		"properties": map[string]interface{}{
+			"data": map[string]interface{}{},
+			"meta": map[string]interface{}{"type": "object"},
+		},
+	},
+	"Error": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"code", "message"},
+				"properties": map[string]interface{}{
+					"code":    map[string]interface{}{"type": "string"},
+					"message": map[string]interface{}{"type": "string"},
+					"details": map[string]interface{}{
+						"type":  "array",
+						"items": schemaRef("FieldError"),
+					},
+				},
+			},
+		},
+	},
+	"FieldError": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"field":   map[string]interface{}{"type": "string"},
+			"rule":    map[string]interface{}{"type": "string"},
+			"message": map[string]interface{}{"type": "string"},
+		},
+	},
+}
+
+var openAPISecuritySchemes = map[string]interface{}{
+	"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+	"basicAuth":  map[string]interface{}{"type": "http", "scheme": "basic"},
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	router := newTestRouter(t)
+	rec := serveRequest(router, "GET", "/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json = %d, want 200", rec.Code)
+	}
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("the spec is not JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Version != version {
+		t.Errorf("got openapi %q and version %q", doc.OpenAPI, doc.Info.Version)
+	}
+
+	tests := []struct {
+		path    string
+		methods []string
+	}{
+		{path: "/v1/hello", methods: []string{"get", "post"}},
+		{path: "/v1/system", methods: []string{"get"}},
+		{path: "/v1/kv/{key}", methods: []string{"delete", "get", "put"}},
+		{path: "/health", methods: []string{"get"}},
+	}
+	for _, tt := range tests {
+		operations, ok := doc.Paths[tt.path]
+		if !ok {
+			t.Errorf("the spec has no %s", tt.path)
+			continue
+		}
+		var methods []string
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		if !reflect.DeepEqual(methods, tt.methods) {
+			t.Errorf("%s has the methods %v, want %v", tt.path, methods, tt.methods)
+		}
+	}
+
+	// The deprecated paths without /v1 are left out, like on the landing page
+	if _, ok := doc.Paths["/hello"]; ok {
+		t.Error("the spec has the deprecated /hello")
+	}
+
+	// Path variables are parameters, without the pattern of the route
+	params := doc.Paths["/v1/notes/{id}"]["get"].Parameters
+	if len(params) != 1 || params[0].Name != "id" || params[0].In != "path" || !params[0].Required {
+		t.Errorf("GET /v1/notes/{id} has the parameters %+v, want the path parameter id", params)
+	}
+
+	// Endpoints that need a token say so
+	if security := doc.Paths["/v1/me"]["get"].Security; len(security) == 0 {
+		t.Error("GET /v1/me has no security requirement")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// pprofPrefix is where the profiling endpoints are served.
+const pprofPrefix = "/debug/pprof/"
+
+// registerPprofRoutes registers the profiling endpoints of the net/http/pprof
+// package under /debug/pprof/. The go tool reads them, e.g.
+// go tool pprof http://localhost:5000/debug/pprof/heap
+func registerPprofRoutes(router *mux.Router) {
+	/*
+		Importing net/http/pprof also adds these endpoints to http.DefaultServeMux,
+		but this program doesn't serve that one, so they are added to our own
+		router here. pprof.Index serves the list at /debug/pprof/ and every named
+		profile below it, like /debug/pprof/heap and /debug/pprof/goroutine.
+	*/
+	debug := router.PathPrefix("/debug/pprof").Subrouter()
+	debug.Use(withoutWriteDeadline)
+	debug.HandleFunc("/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/profile", pprof.Profile)
+	debug.HandleFunc("/symbol", pprof.Symbol)
+	debug.HandleFunc("/trace", pprof.Trace)
+	debug.PathPrefix("/").HandlerFunc(pprof.Index)
+}
+
+// withoutWriteDeadline turns off the WriteTimeout of the server for the
+// requests it handles. A CPU profile or trace takes as long as the seconds
+// query parameter asks for, e.g. 30 by default for /debug/pprof/profile, which
+// is longer than the WriteTimeout of 20 seconds.
+func withoutWriteDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like in streamEvents, a zero time means no deadline
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		/*
+			The pprof handlers look up the server in the request context to check
+			its WriteTimeout, and older Go versions refuse a profile that is longer
+			than it. Without the server in the context they leave the deadline alone.
+		*/
+		ctx := context.WithValue(r.Context(), http.ServerContextKey, nil)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
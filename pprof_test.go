@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPprofRoutes(t *testing.T) {
+	tests := []struct {
+		enabled bool
+		status  int
+	}{
+		{enabled: false, status: http.StatusNotFound},
+		{enabled: true, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.EnablePprof = tt.enabled
+		router, err := buildRouter(cfg, testServices(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, target := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+			if rec := serveRequest(router, "GET", target, ""); rec.Code != tt.status {
+				t.Errorf("GET %s with profiling enabled %v = %d, want %d", target, tt.enabled, rec.Code, tt.status)
+			}
+		}
+	}
+}
+
+func TestTimeoutMiddlewareExempt(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	h := timeoutMiddleware(20*time.Millisecond, pprofPrefix)(slow)
+
+	if rec := serveRequest(h, "GET", "/debug/pprof/profile", ""); rec.Code != http.StatusOK || rec.Body.String() != "done" {
+		t.Errorf("a slow profile = %d %q, want 200 done", rec.Code, rec.Body)
+	}
+	if rec := serveRequest(h, "GET", "/v1/hello", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("a slow request elsewhere = %d, want 503", rec.Code)
+	}
+}
+
+func TestPprofProfileOutlastsTimeouts(t *testing.T) {
+	// Both timeouts are far shorter than the profile of one second
+	cfg := defaultConfig()
+	cfg.EnablePprof = true
+	cfg.RequestTimeout.Duration = 100 * time.Millisecond
+	cfg.WriteTimeout.Duration = 200 * time.Millisecond
+
+	shared := testServices(t)
+	router, err := buildRouter(cfg, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(newHandler(cfg, router, shared))
+	srv.Config.WriteTimeout = cfg.WriteTimeout.Duration
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/debug/pprof/profile?seconds=1")
+	if err != nil {
+		t.Fatalf("the profile was cut off: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("the profile was cut off while reading it: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("GET /debug/pprof/profile?seconds=1 = %d with %d bytes, want 200 and a profile\n%s", resp.StatusCode, len(body), body)
+	}
+}
+
+func TestWithoutWriteDeadline(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	tests := []struct {
+		name    string
+		handler http.Handler
+		wantOK  bool
+	}{
+		{name: "with deadline", handler: slow},
+		{name: "without deadline", handler: withoutWriteDeadline(slow), wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(tt.handler)
+			srv.Config.WriteTimeout = 100 * time.Millisecond
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			// Writing after the deadline fails, so the client gets no response
+			resp, err := http.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Errorf("got a response %v (%v), want %v", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+)
+
+// problemJSON switches the shared error responses to the standard format of
+// RFC 7807, set with PROBLEM_JSON=true. It is set once in main before the
+// server starts, like logger.
+var problemJSON bool
+
+// problem is an error in the format of RFC 7807, "Problem Details for HTTP
+// APIs". Type is a URL that names the kind of problem, and "about:blank"
+// means that the status code already says it all. Instance is the path of the
+// request that failed. The RFC allows extra fields, which is where the fields
+// that failed validation go.
+//
+//	{"type": "about:blank", "title": "Not Found", "status": 404,
+//	 "detail": "not found", "instance": "/v1/nope"}
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance"`
+	Details  []fieldError `json:"details,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, title, detail string) {
+	writeProblemJSON(w, r, problem{
+		Type:     "about:blank",
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+func writeProblemJSON(w http.ResponseWriter, r *http.Request, p problem) {
+	// The RFC gives problems their own content type, so clients can tell them apart
+	w.Header().Set("Content-Type", "application/problem+json")
+	encodeJSON(w, r, p.Status, p)
+}
+
+// writeAPIError is writeError for the errors every endpoint can run into, like
+// 404, 405, a 400 for an invalid body, query or path, and 500. With
+// PROBLEM_JSON=true they are sent as a problem, otherwise in the usual
+// "error" envelope.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if !problemJSON {
+		writeError(w, r, status, code, message)
+		return
+	}
+	// http.StatusText gives the standard name of the status, like "Not Found"
+	writeProblem(w, r, status, http.StatusText(status), message)
+}
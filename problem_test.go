@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingTodos is a TodoRepository whose List always fails, to get a 500.
+type failingTodos struct {
+	TodoRepository
+}
+
+func (failingTodos) List(limit, offset int) ([]todo, int, error) {
+	return nil, 0, errors.New("the database is gone")
+}
+
+func TestProblemJSON(t *testing.T) {
+	problemJSON = true
+	t.Cleanup(func() { problemJSON = false })
+
+	shared := testServices(t)
+	shared.todos = failingTodos{}
+	router := newV1Router(t, shared)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantPath   string
+	}{
+		{name: "not found", method: "GET", target: "/nope", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: "PATCH", target: "/hello", wantStatus: http.StatusMethodNotAllowed},
+		{name: "invalid JSON", method: "POST", target: "/hello", body: "{", wantStatus: http.StatusBadRequest},
+		{name: "unknown field", method: "POST", target: "/hello", body: `{"name": "Yoda", "age": 900}`, wantStatus: http.StatusBadRequest},
+		{name: "hash algorithm", method: "GET", target: "/hash/sha512?input=yoda", wantStatus: http.StatusBadRequest},
+		{name: "hash input", method: "GET", target: "/hash/md5", wantStatus: http.StatusBadRequest},
+		{name: "base64", method: "POST", target: "/base64/decode", body: "not base64!", wantStatus: http.StatusBadRequest},
+		{name: "timezone", method: "GET", target: "/time?tz=Mars/Olympus", wantStatus: http.StatusBadRequest},
+		{name: "uuid count", method: "GET", target: "/uuid?count=0", wantStatus: http.StatusBadRequest},
+		{name: "random range", method: "GET", target: "/random?min=5&max=1", wantStatus: http.StatusBadRequest},
+		{name: "notes query", method: "GET", target: "/notes?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "todos query", method: "GET", target: "/todos?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "print", method: "GET", target: "/print/" + strings.Repeat("a", defaultMaxPrintBytes+1), wantStatus: http.StatusBadRequest},
+		{name: "transform", method: "GET", target: "/transform/upper/" + strings.Repeat("a", defaultMaxPrintBytes+1), wantStatus: http.StatusBadRequest},
+		{name: "reverse", method: "GET", target: "/reverse/" + strings.Repeat("a", defaultMaxPrintBytes+1), wantStatus: http.StatusBadRequest},
+		{name: "download", method: "GET", target: `/download/..%5Cmain.go`, wantStatus: http.StatusBadRequest, wantPath: `/download/..\main.go`},
+		{name: "upload", method: "POST", target: "/upload", body: "not a form", wantStatus: http.StatusBadRequest},
+		{name: "storage", method: "GET", target: "/todos", wantStatus: http.StatusInternalServerError},
+		{name: "missing key", method: "GET", target: "/kv/nope", wantStatus: http.StatusNotFound},
+		{name: "missing key update", method: "PUT", target: "/kv/nope", body: `{"value": "x"}`, wantStatus: http.StatusNotFound},
+		{name: "missing key delete", method: "DELETE", target: "/kv/nope", wantStatus: http.StatusNotFound},
+		{name: "missing note", method: "GET", target: "/notes/99", wantStatus: http.StatusNotFound},
+		{name: "missing note update", method: "PUT", target: "/notes/99", body: `{"body": "x"}`, wantStatus: http.StatusNotFound},
+		{name: "missing note delete", method: "DELETE", target: "/notes/99", wantStatus: http.StatusNotFound},
+		{name: "missing file", method: "GET", target: "/download/nope.txt", wantStatus: http.StatusNotFound},
+		{name: "login without credentials", method: "POST", target: "/login", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, tt.method, tt.target, tt.body)
+			wantPath := tt.wantPath
+			if wantPath == "" {
+				wantPath, _, _ = strings.Cut(tt.target, "?")
+			}
+			checkProblem(t, rec, tt.wantStatus, wantPath)
+		})
+	}
+}
+
+// checkProblem checks that rec is a problem with the status and the path as
+// instance, with all five fields of the RFC and nothing else.
+func checkProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, path string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("got %d, want %d\n%s", rec.Code, status, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Content-Type is %q, want application/problem+json", got)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("could not decode %s: %v", rec.Body, err)
+	}
+	if got := sortedKeys(fields); !reflect.DeepEqual(got, []string{"detail", "instance", "status", "title", "type"}) {
+		t.Errorf("the problem has the fields %v", got)
+	}
+
+	var p problem
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	if p.Type != "about:blank" || p.Title != http.StatusText(status) || p.Status != status || p.Detail == "" || p.Instance != path {
+		t.Errorf("got %+v, want a %d problem for %s", p, status, path)
+	}
+}
+
+func TestProblemJSONMissingResources(t *testing.T) {
+	problemJSON = true
+	t.Cleanup(func() { problemJSON = false })
+
+	// The todos of TestProblemJSON always fail, so the missing ones are checked here
+	router := newV1Router(t, testServices(t))
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		rec := serveRequest(router, method, "/todos/99", `{"title": "x"}`)
+		checkProblem(t, rec, http.StatusNotFound, "/todos/99")
+	}
+}
+
+func TestProblemJSONAuthNotConfigured(t *testing.T) {
+	problemJSON = true
+	t.Cleanup(func() { problemJSON = false })
+
+	// Without a JWT secret no token can be given out or checked
+	shared := testServices(t)
+	shared.jwtSecret = nil
+	router := newV1Router(t, shared)
+
+	checkProblem(t, serveRequest(router, "POST", "/login", `{"username": "yoda", "password": "do-or-do-not"}`), http.StatusInternalServerError, "/login")
+	checkProblem(t, serveWithToken(router, "anything"), http.StatusInternalServerError, "/me")
+
+	// The /admin routes refuse every request without a username and password to check
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.SetBasicAuth("", "")
+	rec := httptest.NewRecorder()
+	basicAuthMiddleware("", "")(http.HandlerFunc(hello)).ServeHTTP(rec, req)
+	checkProblem(t, rec, http.StatusInternalServerError, "/admin/stats")
+}
+
+func TestProblemJSONStreamingNotSupported(t *testing.T) {
+	problemJSON = true
+	t.Cleanup(func() { problemJSON = false })
+
+	rec := httptest.NewRecorder()
+	timeStream(noFlushWriter{rec}, httptest.NewRequest("GET", "/events/time", nil))
+	checkProblem(t, rec, http.StatusInternalServerError, "/events/time")
+}
+
+func TestProblemJSONValidation(t *testing.T) {
+	problemJSON = true
+	t.Cleanup(func() { problemJSON = false })
+
+	rec := serveRequest(newV1Router(t, testServices(t)), "POST", "/kv", `{"value": "yoda"}`)
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("POST /kv without a key = %d with Content-Type %q, want a 400 problem", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// The fields that broke a rule are an extra field of the problem
+	var p problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("could not decode %s: %v", rec.Body, err)
+	}
+	want := problem{
+		Type:     "about:blank",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   p.Detail,
+		Instance: "/kv",
+		Details:  []fieldError{{Field: "key", Rule: "required", Message: "key is required"}},
+	}
+	if p.Detail == "" || !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestWithoutProblemJSON(t *testing.T) {
+	// The default is still the "error" envelope
+	rec := serveRequest(newV1Router(t, testServices(t)), "GET", "/uuid?count=0", "")
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type is %q, want application/json", got)
+	}
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusBadRequest || apiErr.Code != "invalid_query" {
+		t.Errorf("GET /uuid?count=0 = %d %+v, want 400 invalid_query", rec.Code, apiErr)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// newReverseProxy returns a handler that forwards every request to the
+// server at upstream, e.g. http://localhost:8080, and sends its response
+// back to the client.
+func newReverseProxy(upstream string) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid UPSTREAM_URL %q: must be a url like http://localhost:8080", upstream)
+	}
+
+	/*
+		NewSingleHostReverseProxy joins the path of every request to the path
+		of target and keeps the query string. The proxy also adds the address
+		of the client to X-Forwarded-For, so the upstream knows who really sent
+		the request. The Host header is set to the upstream, since servers often
+		use it to pick which site to answer with.
+	*/
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+
+	// When the upstream can't be reached, the client gets a JSON error like everywhere else
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Warn("upstream request failed",
+			"request_id", requestIDFromContext(r.Context()),
+			"upstream", upstream,
+			"error", err.Error(),
+		)
+		writeError(w, r, http.StatusBadGateway, "bad_gateway", "the upstream server could not be reached")
+	}
+	return proxy, nil
+}
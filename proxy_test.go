@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// proxyRouter returns the full router with /proxy/ forwarding to upstream.
+func proxyRouter(t *testing.T, upstream string) http.Handler {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.UpstreamURL = upstream
+	router, err := buildRouter(cfg, testServices(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func TestReverseProxy(t *testing.T) {
+	// The upstream sends back what it got, so the test can see what was forwarded
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusTeapot)
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":            r.URL.Path,
+			"query":           r.URL.RawQuery,
+			"host":            r.Host,
+			"x_forwarded_for": r.Header.Get("X-Forwarded-For"),
+			"x_custom":        r.Header.Get("X-Custom"),
+		})
+	}))
+	defer upstream.Close()
+	router := proxyRouter(t, upstream.URL)
+
+	req := httptest.NewRequest("GET", "/proxy/users?page=2", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	req.Header.Set("X-Custom", "dagobah")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// The status, headers and body of the upstream come back as they are
+	if rec.Code != http.StatusTeapot || rec.Header().Get("X-Upstream") != "yes" {
+		t.Fatalf("GET /proxy/users = %d with X-Upstream %q, want the 418 of the upstream", rec.Code, rec.Header().Get("X-Upstream"))
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("could not decode %s: %v", rec.Body, err)
+	}
+	want := map[string]string{
+		"path":            "/users",
+		"query":           "page=2",
+		"host":            upstream.Listener.Addr().String(),
+		"x_forwarded_for": "192.0.2.7",
+		"x_custom":        "dagobah",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("the upstream got %s %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	// Nothing listens on the address once the server is closed
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	rec := serveRequest(proxyRouter(t, upstream.URL), "GET", "/proxy/users", "")
+	if rec.Code != http.StatusBadGateway || decodeError(t, rec).Code != "bad_gateway" {
+		t.Errorf("GET /proxy/users without an upstream = %d %s, want 502 bad_gateway", rec.Code, rec.Body)
+	}
+
+	// Without UPSTREAM_URL there is no /proxy/ route
+	if rec := serveRequest(proxyRouter(t, ""), "GET", "/proxy/users", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /proxy/users without UPSTREAM_URL = %d, want 404", rec.Code)
+	}
+
+	for _, upstream := range []string{"localhost:8080", "ftp://example.com", "http://"} {
+		if _, err := newReverseProxy(upstream); err == nil {
+			t.Errorf("newReverseProxy(%q) gave no error", upstream)
+		}
+	}
+}
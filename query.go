@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// requireIntQuery reads the query parameter name of r as a whole number
+// between min and max. The error explains what is wrong in a way that can be
+// sent to the client as is, e.g. with writeError and 400 Bad Request.
+func requireIntQuery(r *http.Request, name string, min, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number, got %q", name, value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %d", name, min, max, n)
+	}
+	return n, nil
+}
+
+// Default and largest number of items a list endpoint returns at once, see
+// pageQuery.
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// page is the "meta" of a paginated list: the total number of items, and
+// which part of them the response has.
+type page struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// pageQuery reads the optional ?limit= and ?offset= query parameters of a
+// list endpoint. Without them the first defaultPageLimit items are returned.
+func pageQuery(r *http.Request) (limit, offset int, err error) {
+	limit, offset = defaultPageLimit, 0
+	if r.URL.Query().Has("limit") {
+		if limit, err = requireIntQuery(r, "limit", 1, maxPageLimit); err != nil {
+			return 0, 0, err
+		}
+	}
+	if r.URL.Query().Has("offset") {
+		if offset, err = requireIntQuery(r, "offset", 0, math.MaxInt32); err != nil {
+			return 0, 0, err
+		}
+	}
+	return limit, offset, nil
+}
+
+// pageBounds returns the start and end index of the items of a page in a
+// list of total items. Slicing with them never goes out of range, even when
+// offset is past the end of the list.
+func pageBounds(total, limit, offset int) (start, end int) {
+	start = min(offset, total)
+	end = min(start+limit, total)
+	return start, end
+}
+
+// sortQuery reads the optional ?sort= and ?order= query parameters of a list
+// endpoint. sort has to be one of fields, and the first one is the default.
+// order is asc (the default) or desc.
+func sortQuery(r *http.Request, fields ...string) (field string, desc bool, err error) {
+	field = fields[0]
+	if value := r.URL.Query().Get("sort"); value != "" {
+		if !slices.Contains(fields, value) {
+			return "", false, fmt.Errorf("sort must be one of %s, got %q", strings.Join(fields, ", "), value)
+		}
+		field = value
+	}
+
+	switch order := r.URL.Query().Get("order"); order {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return "", false, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+	return field, desc, nil
+}
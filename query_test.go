@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireIntQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr string
+	}{
+		{name: "valid", query: "?n=5", want: 5},
+		{name: "lowest", query: "?n=1", want: 1},
+		{name: "highest", query: "?n=10", want: 10},
+		{name: "missing", query: "", wantErr: "n is required"},
+		{name: "empty", query: "?n=", wantErr: "n is required"},
+		{name: "not a number", query: "?n=five", wantErr: `n must be a whole number, got "five"`},
+		{name: "decimal", query: "?n=2.5", wantErr: `n must be a whole number, got "2.5"`},
+		{name: "too small", query: "?n=0", wantErr: "n must be between 1 and 10, got 0"},
+		{name: "too large", query: "?n=11", wantErr: "n must be between 1 and 10, got 11"},
+		{name: "overflow", query: "?n=" + strings.Repeat("9", 30), wantErr: "n must be a whole number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requireIntQuery(httptest.NewRequest("GET", "/"+tt.query, nil), "n", 1, 10)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("got %d, %v, want the error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	"net/http"
+)
+
+// randomInt returns a random whole number from min to max, both included.
+func randomInt(min, max int) int {
+	/*
+		rand.Int gives a number from 0 up to, but not including, the limit, and
+		every number is equally likely. Taking a random number modulo the size
+		of the range instead would make the small numbers come up more often.
+	*/
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)-int64(min)+1))
+	if err != nil {
+		panic(err)
+	}
+	return min + int(n.Int64())
+}
+
+func getRandom(w http.ResponseWriter, r *http.Request) {
+	/*
+		Without query parameters a single number from 0 to 100 is returned.
+		?min= and ?max= choose another range, and ?count= returns a list of up
+		to 1000 numbers under "values" instead.
+	*/
+	min, max, count := 0, 100, 1
+	var err error
+	if r.URL.Query().Has("min") {
+		if min, err = requireIntQuery(r, "min", math.MinInt32, math.MaxInt32); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+	}
+	if r.URL.Query().Has("max") {
+		if max, err = requireIntQuery(r, "max", math.MinInt32, math.MaxInt32); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+	}
+	if r.URL.Query().Has("count") {
+		if count, err = requireIntQuery(r, "count", 1, 1000); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+	}
+	if min > max {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_query", "min must not be larger than max")
+		return
+	}
+
+	if count == 1 {
+		writeSuccess(w, r, http.StatusOK, map[string]int{"value": randomInt(min, max)})
+		return
+	}
+	values := make([]int, count)
+	for i := range values {
+		values[i] = randomInt(min, max)
+	}
+	writeSuccess(w, r, http.StatusOK, map[string][]int{"values": values})
+}
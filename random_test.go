@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRandomSingle(t *testing.T) {
+	tests := []struct {
+		query    string
+		min, max int
+	}{
+		{query: "", min: 0, max: 100},
+		{query: "?min=5&max=10", min: 5, max: 10},
+		{query: "?min=-3&max=-1", min: -3, max: -1},
+		{query: "?min=7&max=7", min: 7, max: 7},
+		{query: "?min=" + strconv.Itoa(math.MinInt32) + "&max=" + strconv.Itoa(math.MaxInt32), min: math.MinInt32, max: math.MaxInt32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			// Run it a few times, so a wrong range is likely to show up
+			for i := 0; i < 50; i++ {
+				rec := serveRequest(http.HandlerFunc(getRandom), "GET", "/random"+tt.query, "")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET /random%s = %d, want 200\n%s", tt.query, rec.Code, rec.Body)
+				}
+				var got map[string]int
+				decodeData(t, rec, &got)
+				value, ok := got["value"]
+				if !ok || len(got) != 1 || value < tt.min || value > tt.max {
+					t.Fatalf("GET /random%s = %v, want a value from %d to %d", tt.query, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomCount(t *testing.T) {
+	for _, count := range []int{2, 10, 1000} {
+		target := "/random?min=1&max=6&count=" + strconv.Itoa(count)
+		rec := serveRequest(http.HandlerFunc(getRandom), "GET", target, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200\n%s", target, rec.Code, rec.Body)
+		}
+		var got map[string][]int
+		decodeData(t, rec, &got)
+		if len(got["values"]) != count {
+			t.Fatalf("GET %s gave %d values, want %d", target, len(got["values"]), count)
+		}
+
+		seen := map[int]bool{}
+		for _, v := range got["values"] {
+			if v < 1 || v > 6 {
+				t.Fatalf("GET %s gave %d, want 1 to 6", target, v)
+			}
+			seen[v] = true
+		}
+		// 1000 throws of a die show every side, unless the numbers aren't random
+		if count == 1000 && len(seen) != 6 {
+			t.Errorf("1000 values only had %d different numbers", len(seen))
+		}
+	}
+}
+
+func TestRandomErrors(t *testing.T) {
+	tests := []string{
+		"?min=10&max=5",
+		"?max=-1",
+		"?count=0",
+		"?count=1001",
+		"?min=low",
+		"?max=" + strconv.Itoa(math.MaxInt32+1),
+	}
+	for _, query := range tests {
+		rec := serveRequest(http.HandlerFunc(getRandom), "GET", "/random"+query, "")
+		if apiErr := decodeError(t, rec); rec.Code != http.StatusBadRequest || apiErr.Code != "invalid_query" {
+			t.Errorf("GET /random%s = %d %+v, want 400 invalid_query", query, rec.Code, apiErr)
+		}
+	}
+
+	rec := serveRequest(http.HandlerFunc(getRandom), "GET", "/random?min=10&max=5", "")
+	if got := decodeError(t, rec).Message; got != "min must not be larger than max" {
+		t.Errorf("min > max gave the message %q", got)
+	}
+}
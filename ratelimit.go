@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter gives every client its own token bucket. A bucket holds up to
+// burst tokens and is refilled with rps tokens per second; each request takes
+// one token, and a client whose bucket is empty has to wait.
+type rateLimiter struct {
+	mu        sync.Mutex
+	clients   map[string]*client
+	rps       rate.Limit
+	burst     int
+	lastPrune time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// clientIdleTimeout is how long a client has to be away before its bucket is forgotten.
+const clientIdleTimeout = 3 * time.Minute
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		clients:   map[string]*client{},
+		rps:       rate.Limit(rps),
+		burst:     burst,
+		lastPrune: time.Now(),
+	}
+}
+
+func (rl *rateLimiter) limiterFor(ip string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	/*
+		Without cleaning up, the map would grow with every new client forever.
+		About once per clientIdleTimeout the clients that have been idle for
+		that long are removed; a full bucket is the same as a new one anyway.
+	*/
+	now := time.Now()
+	if now.Sub(rl.lastPrune) > clientIdleTimeout {
+		for key, c := range rl.clients {
+			if now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(rl.clients, key)
+			}
+		}
+		rl.lastPrune = now
+	}
+
+	c, exists := rl.clients[ip]
+	if !exists {
+		c = &client{limiter: rate.NewLimiter(rl.rps, rl.burst)}
+		rl.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	/*
+		Retry-After tells the client how many whole seconds to wait, which is the
+		time it takes to get a new token, rounded up.
+	*/
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(1/float64(rl.rps)))))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rl.limiterFor(clientIP(r)).Allow() {
+			w.Header().Set("Retry-After", retryAfter)
+			writeError(w, r, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trustProxy makes resolveClientIP believe the X-Forwarded-For and X-Real-IP
+// headers, set with TRUST_PROXY=true. It is set once in main before the
+// server starts, like problemJSON.
+var trustProxy bool
+
+func clientIP(r *http.Request) string {
+	ip, _ := resolveClientIP(r)
+	return ip
+}
+
+// resolveClientIP returns the IP address of the client of r, and where it was
+// found: "x-forwarded-for", "x-real-ip" or "remote_addr".
+func resolveClientIP(r *http.Request) (ip, via string) {
+	/*
+		Behind a proxy or load balancer r.RemoteAddr is the address of the proxy.
+		Proxies put the address of the real client first in X-Forwarded-For, and
+		some, like nginx, in X-Real-IP. Clients can send those headers themselves
+		too, and with a new made-up address in every request they would get
+		around the rate limit. So the headers are only used with TRUST_PROXY,
+		which says the server runs behind a proxy that sets them.
+	*/
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first := strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			if first != "" {
+				return first, "x-forwarded-for"
+			}
+		}
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			return realIP, "x-real-ip"
+		}
+	}
+
+	// RemoteAddr is host:port, only the host part identifies the client
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr, "remote_addr"
+	}
+	return host, "remote_addr"
+}
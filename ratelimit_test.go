@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	// One token per second is refilled far slower than the test sends requests
+	rl := newRateLimiter(1, 3)
+	h := rl.middleware(http.HandlerFunc(hello))
+
+	for i := 0; i < 3; i++ {
+		if rec := serveRequest(h, "GET", "/hello", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d of the burst = %d, want 200", i+1, rec.Code)
+		}
+	}
+
+	rec := serveRequest(h, "GET", "/hello", "")
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusTooManyRequests || apiErr.Code != "rate_limited" {
+		t.Fatalf("request after the burst = %d %+v, want 429 rate_limited", rec.Code, apiErr)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
+
+func TestRateLimiterIgnoresForwardedHeadersByDefault(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	h := rl.middleware(http.HandlerFunc(hello))
+
+	// Without TRUST_PROXY a made-up X-Forwarded-For doesn't give a client a new bucket
+	codes := map[int]int{}
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/hello", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes[rec.Code]++
+	}
+	if codes[http.StatusOK] != 1 || codes[http.StatusTooManyRequests] != 4 {
+		t.Errorf("got status codes %v, want 1 request allowed and 4 limited", codes)
+	}
+	if len(rl.clients) != 1 {
+		t.Errorf("the limiter has %d clients, want 1", len(rl.clients))
+	}
+}
+
+// sendFrom sends a request to h from the address remoteAddr, with the
+// X-Forwarded-For header set when forwardedFor isn't empty.
+func sendFrom(h http.Handler, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest("GET", "/hello", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRateLimiterPerClient(t *testing.T) {
+	h := newRateLimiter(1, 1).middleware(http.HandlerFunc(hello))
+
+	// The port isn't part of the key, so new connections don't get a new bucket
+	if sendFrom(h, "192.0.2.1:1000", "") != http.StatusOK || sendFrom(h, "192.0.2.1:2000", "") != http.StatusTooManyRequests {
+		t.Error("a client got a second request in on another port")
+	}
+	if got := sendFrom(h, "192.0.2.2:1000", ""); got != http.StatusOK {
+		t.Errorf("another client = %d, want 200", got)
+	}
+}
+
+func TestRateLimiterTrustProxy(t *testing.T) {
+	trustProxy = true
+	t.Cleanup(func() { trustProxy = false })
+	h := newRateLimiter(1, 1).middleware(http.HandlerFunc(hello))
+
+	// Behind a proxy every client has the address of the proxy, so the header decides
+	if sendFrom(h, "10.0.0.1:1000", "203.0.113.1") != http.StatusOK || sendFrom(h, "10.0.0.1:1000", "203.0.113.2, 10.0.0.1") != http.StatusOK {
+		t.Error("two clients behind the same proxy share a bucket")
+	}
+	if got := sendFrom(h, "10.0.0.1:1000", "203.0.113.1"); got != http.StatusTooManyRequests {
+		t.Errorf("the second request of a client behind the proxy = %d, want 429", got)
+	}
+}
+
+func TestRateLimitFromEnvironment(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "2.5")
+	t.Setenv("RATE_LIMIT_BURST", "7")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimitRPS != 2.5 || cfg.RateLimitBurst != 7 {
+		t.Errorf("got rate %v and burst %d, want 2.5 and 7", cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+
+	for name, value := range map[string]string{"RATE_LIMIT_RPS": "0", "RATE_LIMIT_BURST": "1.5"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := resolveConfig(flags{}); err == nil {
+				t.Errorf("%s=%s gave no error", name, value)
+			}
+		})
+	}
+}
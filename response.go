@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	/*
+		Headers have to be set before the status code is written, because
+		WriteHeader sends the status line and all headers to the client right away.
+		Setting the Content-Type tells the client that the body is JSON.
+	*/
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSON(w, r, status, v)
+}
+
+// encodeJSON writes the status and v as the body. Every JSON response goes
+// through here, so ?pretty=true works on all of them.
+func encodeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	/*
+		With ?pretty=true in the url the output is indented, otherwise it is compact.
+		json.MarshalIndent works like json.Marshal, but puts every field on its own
+		line indented with two spaces, which is much easier to read for humans.
+	*/
+	if wantsPretty(r) {
+		body, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(append(body, '\n'))
+		return
+	}
+
+	w.WriteHeader(status)
+
+	/*
+		To deliver the data to the user in JSON format, a json encoder is used where
+		v is encoded using a new json encoder based on the http.ResponseWriter w
+		(it acts as a channel to write through).
+	*/
+	json.NewEncoder(w).Encode(v)
+}
+
+func wantsPretty(r *http.Request) bool {
+	return r.URL.Query().Get("pretty") == "true"
+}
+
+// Every JSON response has the same shape, so clients only have to know one
+// format. Success responses put the result under "data", with room for extra
+// information like paging under "meta":
+//
+//	{"data": {"key": "name", "value": "yoda"}}
+//
+// Errors put an APIError under "error". Its code is a short name that stays the
+// same when the message is reworded, so clients can check for it in their code:
+//
+//	{"error": {"code": "key_not_found", "message": "key not found"}}
+type APIResponse struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []fieldError `json:"details,omitempty"`
+}
+
+func writeSuccess(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	writeJSON(w, r, status, APIResponse{Data: data})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeJSON(w, r, status, map[string]APIError{
+		"error": {Code: code, Message: message},
+	})
+}
+
+func writeReadError(w http.ResponseWriter, r *http.Request, err error) {
+	/*
+		errors.As checks if err is (or wraps) an *http.MaxBytesError, which is what
+		reading the body returns when it is larger than maxBodyBytesMiddleware allows.
+	*/
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	writeAPIError(w, r, http.StatusBadRequest, "invalid_body", "could not read request body")
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeReadError(w, r, err)
+		return
+	}
+
+	// decodeAndValidate also returns the fields that broke a validate rule
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		writeValidationError(w, r, invalid)
+		return
+	}
+
+	/*
+		A decoder with DisallowUnknownFields fails on fields the struct doesn't
+		have. The json package has no error type for it, only the text
+		json: unknown field "name", so the name is taken from there.
+	*/
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		writeAPIError(w, r, http.StatusBadRequest, "unknown_field", "the field "+field+" is not allowed")
+		return
+	}
+	writeAPIError(w, r, http.StatusBadRequest, "invalid_json", "invalid JSON body: "+err.Error())
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}, pretty bool) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	// xml.Header is the standard <?xml ...?> line that starts an XML document
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	if pretty {
+		encoder.Indent("", "  ")
+	}
+	encoder.Encode(v)
+}
+
+func respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	/*
+		The Accept header is how a client tells which formats it wants back, this
+		is called content negotiation. We send XML when the client asks for it and
+		JSON in every other case. v has to be a struct for the XML encoding to work,
+		so new handlers returning a struct should use respond instead of writeSuccess.
+		XML documents already have a root element, so only JSON gets the "data"
+		envelope. ?pretty=true indents both formats.
+	*/
+	if strings.Contains(r.Header.Get("Accept"), "application/xml") {
+		writeXML(w, status, v, wantsPretty(r))
+		return
+	}
+	writeSuccess(w, r, status, v)
+}
+
+// The xml package can't encode maps, so xmlMap and xmlMultiMap are maps with a
+// MarshalXML method that writes each key as an <entry key="..."> element.
+// They are still maps, so the json package encodes them like before.
+type xmlMap map[string]string
+
+func (m xmlMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	multi := xmlMultiMap{}
+	for key, value := range m {
+		multi[key] = []string{value}
+	}
+	return multi.MarshalXML(e, start)
+}
+
+type xmlMultiMap map[string][]string
+
+func (m xmlMultiMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	// Maps have no order in Go, so the keys are sorted to give the same output every time
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range m[key] {
+			entry := xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+			}
+			if err := e.EncodeElement(value, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
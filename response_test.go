@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestJSONContentType(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{name: "success", method: "POST", target: "/hello", body: `{"name": "Yoda"}`},
+		{name: "error", method: "POST", target: "/hello", body: "{"},
+		{name: "system", method: "GET", target: "/system"},
+		{name: "not found", method: "GET", target: "/nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, tt.method, tt.target, tt.body)
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("%s %s has Content-Type %q, want application/json", tt.method, tt.target, got)
+			}
+		})
+	}
+}
+
+func TestRespondAcceptHeader(t *testing.T) {
+	tests := []struct {
+		accept   string
+		wantType string
+	}{
+		{accept: "application/xml", wantType: "application/xml"},
+		{accept: "application/json", wantType: "application/json"},
+		{accept: "", wantType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/system", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			getSystemInfo(rec, req)
+
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Fatalf("Accept %q gave Content-Type %q, want %q", tt.accept, got, tt.wantType)
+			}
+
+			var info SystemInfo
+			var err error
+			if tt.wantType == "application/xml" {
+				err = xml.Unmarshal(rec.Body.Bytes(), &info)
+			} else {
+				err = json.Unmarshal(rec.Body.Bytes(), &APIResponse{Data: &info})
+			}
+			if err != nil {
+				t.Fatalf("could not decode the response: %v\n%s", err, rec.Body)
+			}
+			if info.GoVersion == "" {
+				t.Errorf("decoded %+v, want the system info", info)
+			}
+		})
+	}
+}
+
+func TestErrorResponseStructure(t *testing.T) {
+	rec := serveRequest(newV1Router(t, testServices(t)), "GET", "/kv/nope", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /kv/nope = %d, want 404", rec.Code)
+	}
+
+	// The error is nested under "error", and there is nothing else in the body
+	var body map[string]map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not decode %s: %v", rec.Body, err)
+	}
+	want := map[string]string{"code": "key_not_found", "message": "key not found"}
+	if len(body) != 1 || !reflect.DeepEqual(body["error"], want) {
+		t.Errorf("got %v, want {\"error\": %v}", body, want)
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	// The same payload comes back indented with ?pretty=true, for data and errors
+	for _, target := range []string{"/hash/sha256?input=hello", "/kv/nope?"} {
+		compact := serveRequest(router, "GET", target, "")
+		pretty := serveRequest(router, "GET", target+"&pretty=true", "")
+		if compact.Code != pretty.Code {
+			t.Errorf("GET %s = %d, but %d with ?pretty=true", target, compact.Code, pretty.Code)
+		}
+
+		var want bytes.Buffer
+		if err := json.Indent(&want, bytes.TrimSpace(compact.Body.Bytes()), "", "  "); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(pretty.Body.String()); got != want.String() {
+			t.Errorf("GET %s&pretty=true gave\n%s\nwant\n%s", target, got, want.String())
+		}
+		if strings.Contains(compact.Body.String(), "\n  ") {
+			t.Errorf("GET %s is indented without ?pretty=true:\n%s", target, compact.Body)
+		}
+	}
+
+	// Handlers that don't use respond are indented too
+	full := newTestRouter(t)
+	rec := serveRequest(full, "GET", "/health?pretty=true", "")
+	if !strings.Contains(rec.Body.String(), "\n  \"data\": {\n    \"status\": \"ok\"") {
+		t.Errorf("GET /health?pretty=true is not indented:\n%s", rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("GET /health?pretty=true has Content-Type %q", got)
+	}
+}
+
+func TestRequestInfoNegotiation(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	t.Run("xml", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/request-info/yoda?planet=dagobah", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Type"); got != "application/xml" {
+			t.Fatalf("Content-Type is %q, want application/xml", got)
+		}
+
+		// The maps are written as <entry key="..."> elements
+		type entry struct {
+			Key   string `xml:"key,attr"`
+			Value string `xml:",chardata"`
+		}
+		var info struct {
+			XMLName    xml.Name `xml:"request_info"`
+			Path       string   `xml:"path"`
+			HTTPMethod string   `xml:"http_method"`
+			Params     []entry  `xml:"dynamic_url_parameters>entry"`
+			Query      []entry  `xml:"query_parameters>entry"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatalf("the response is not XML: %v\n%s", err, rec.Body)
+		}
+		if info.Path != "/request-info/yoda" || info.HTTPMethod != "GET" {
+			t.Errorf("got %s %s, want GET /request-info/yoda", info.HTTPMethod, info.Path)
+		}
+		if !reflect.DeepEqual(info.Params, []entry{{Key: "params", Value: "yoda"}}) || !reflect.DeepEqual(info.Query, []entry{{Key: "planet", Value: "dagobah"}}) {
+			t.Errorf("got params %v and query %v", info.Params, info.Query)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/request-info/yoda?planet=dagobah", nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Fatalf("Content-Type is %q, want application/json", got)
+		}
+
+		var info RequestInfo
+		decodeData(t, rec, &info)
+		if info.Path != "/request-info/yoda" || info.DynamicURLParameters["params"] != "yoda" || !reflect.DeepEqual(info.QueryParameters["planet"], []string{"dagobah"}) {
+			t.Errorf("got %+v", info)
+		}
+	})
+}
+
+func TestEnvelopeShapes(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+	serveRequest(router, "POST", "/todos", `{"title": "Lift the X-wing"}`)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantKeys   []string
+		wantErrors []string
+	}{
+		{name: "data", method: "GET", target: "/hash/md5?input=yoda", wantKeys: []string{"data"}},
+		{name: "data and meta", method: "GET", target: "/todos", wantKeys: []string{"data", "meta"}},
+		{name: "error", method: "GET", target: "/kv/nope", wantKeys: []string{"error"}, wantErrors: []string{"code", "message"}},
+		{name: "error with details", method: "POST", target: "/todos", body: `{"title": ""}`, wantKeys: []string{"error"}, wantErrors: []string{"code", "details", "message"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, tt.method, tt.target, tt.body)
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("could not decode %s: %v", rec.Body, err)
+			}
+			if got := sortedKeys(body); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("%s %s has the keys %v, want %v", tt.method, tt.target, got, tt.wantKeys)
+			}
+			if tt.wantErrors == nil {
+				return
+			}
+
+			var apiErr map[string]json.RawMessage
+			json.Unmarshal(body["error"], &apiErr)
+			if got := sortedKeys(apiErr); !reflect.DeepEqual(got, tt.wantErrors) {
+				t.Errorf("the error has the keys %v, want %v", got, tt.wantErrors)
+			}
+		})
+	}
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
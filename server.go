@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish when the server stops.
+const shutdownTimeout = 10 * time.Second
+
+// isReady reports whether the server is ready to receive traffic, see /ready.
+// It is read and written from different goroutines, so it is only accessed
+// through the sync/atomic functions: 1 means ready and 0 means not ready.
+var isReady int32
+
+// shuttingDown is closed when the server starts shutting down. Handlers that
+// keep running until the client leaves, like event streams, stop when it is
+// closed, otherwise the shutdown would have to wait for them.
+var shuttingDown = make(chan struct{})
+
+func setReady(ready bool) {
+	if ready {
+		atomic.StoreInt32(&isReady, 1)
+	} else {
+		atomic.StoreInt32(&isReady, 0)
+	}
+}
+
+func ready() bool {
+	return atomic.LoadInt32(&isReady) == 1
+}
+
+func newServer(cfg *Config, h http.Handler) *http.Server {
+	/*
+		Without timeouts a client could keep a connection open forever by sending
+		its request very slowly (a so called slowloris attack), and with enough of
+		those the server runs out of connections. ReadHeaderTimeout is shorter
+		than ReadTimeout, so a client that is slow to even send its headers is
+		dropped early. The defaults are in defaultConfig.
+	*/
+	return &http.Server{
+		Addr:              cfg.listenAddr(),
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+
+		// Older TLS versions have known weaknesses, so HTTPS requires at least TLS 1.2
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+func serve(ctx context.Context, srv *http.Server, certFile, keyFile string) error {
+	/*
+		net.Listen opens the port before we start serving, so once it succeeds
+		the server can accept connections and is marked as ready.
+	*/
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	/*
+		Serve blocks until the server stops, so it runs in its own goroutine and
+		reports back through a channel. The buffer of one lets the goroutine
+		finish even if nobody is reading from the channel anymore.
+	*/
+	errs := make(chan error, 1)
+	go func() {
+		// With a certificate and key the server speaks HTTPS, otherwise plain HTTP
+		if certFile != "" {
+			errs <- srv.ServeTLS(listener, certFile, keyFile)
+		} else {
+			errs <- srv.Serve(listener)
+		}
+	}()
+	setReady(true)
+
+	/*
+		select waits for whichever happens first: the server failing (e.g. because
+		the certificate can't be loaded) or the context being cancelled, which
+		happens when the program receives SIGINT (Ctrl+C) or SIGTERM.
+	*/
+	select {
+	case err := <-errs:
+		setReady(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	/*
+		Marking the server as not ready first tells load balancers watching /ready
+		to stop sending new traffic while the in-flight requests finish.
+	*/
+	setReady(false)
+	close(shuttingDown)
+	logger.Info("shutting down gracefully")
+
+	/*
+		Shutdown stops accepting new connections and waits for in-flight requests
+		to finish. If they take longer than shutdownTimeout, the remaining
+		connections are closed by force.
+	*/
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return err
+	}
+
+	logger.Info("shutdown complete")
+	return nil
+}
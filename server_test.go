@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freeAddr returns an address on localhost with a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// startServing runs serve for h on a free port in the background. The
+// returned function stops it with a cancelled context and returns the
+// error of serve.
+func startServing(t *testing.T, h http.Handler, certFile, keyFile string) (addr string, stop func() error) {
+	t.Helper()
+
+	// shuttingDown can only be closed once, so every server gets a new one
+	shuttingDown = make(chan struct{})
+	t.Cleanup(func() { setReady(false) })
+
+	cfg := defaultConfig()
+	cfg.Addr = freeAddr(t)
+	srv := newServer(cfg, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- serve(ctx, srv, certFile, keyFile) }()
+
+	// serve marks the server as ready once it listens
+	deadline := time.Now().Add(2 * time.Second)
+	for !ready() {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("server didn't get ready: %v", <-errs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var stopped bool
+	var stopErr error
+	stop = func() error {
+		if !stopped {
+			stopped = true
+			cancel()
+			stopErr = <-errs
+		}
+		return stopErr
+	}
+	t.Cleanup(func() { stop() })
+	return cfg.Addr, stop
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	addr, stop := startServing(t, http.HandlerFunc(health), "", "")
+
+	resp, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /health = %d, want 200", resp.StatusCode)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("serve returned %v after the shutdown, want nil", err)
+	}
+	if ready() {
+		t.Error("the server is still ready after the shutdown")
+	}
+
+	// The listener is closed, so new connections are refused
+	client := &http.Client{Timeout: time.Second}
+	if resp, err := client.Get("http://" + addr + "/health"); err == nil {
+		resp.Body.Close()
+		t.Error("the server still accepts requests after the shutdown")
+	}
+}
+
+func TestShutdownWaitsForRunningRequests(t *testing.T) {
+	started := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		writeSuccess(w, r, http.StatusOK, "finished")
+	})
+	addr, stop := startServing(t, slow, "", "")
+
+	type result struct {
+		status int
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		results <- result{status: resp.StatusCode}
+	}()
+
+	// The shutdown starts while the request is still being handled
+	<-started
+	if err := stop(); err != nil {
+		t.Fatalf("serve returned %v, want nil", err)
+	}
+
+	res := <-results
+	if res.err != nil || res.status != http.StatusOK {
+		t.Errorf("the running request got %d, %v, want it to finish with 200", res.status, res.err)
+	}
+}
+
+// writeTestCertificate creates a self-signed certificate for 127.0.0.1 in a
+// temporary directory, and returns the files and a pool that trusts it.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, pool
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, pool := writeTestCertificate(t)
+	addr, _ := startServing(t, http.HandlerFunc(health), certFile, keyFile)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatalf("GET https://%s/health = %d over TLS %v, want 200 over TLS", addr, resp.StatusCode, resp.TLS != nil)
+	}
+	if resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("the connection used TLS version %x, want at least 1.2", resp.TLS.Version)
+	}
+
+	// TLS 1.1 and older are refused
+	old := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS11}}}
+	if resp, err := old.Get("https://" + addr + "/health"); err == nil {
+		resp.Body.Close()
+		t.Error("a TLS 1.1 client could connect")
+	}
+}
+
+func TestNewServerDefaults(t *testing.T) {
+	h := http.NotFoundHandler()
+	srv := newServer(defaultConfig(), h)
+
+	if srv.Addr != ":5000" || srv.Handler == nil {
+		t.Errorf("got address %q and handler %v, want :5000 and the handler", srv.Addr, srv.Handler)
+	}
+	if srv.ReadTimeout != 15*time.Second || srv.ReadHeaderTimeout != 5*time.Second || srv.WriteTimeout != 20*time.Second || srv.IdleTimeout != 60*time.Second {
+		t.Errorf("got read %v, read header %v, write %v and idle %v timeouts, want 15s, 5s, 20s and 60s", srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	// The write timeout leaves room for the 503 of a request that timed out
+	if srv.WriteTimeout <= defaultRequestTimeout {
+		t.Errorf("the write timeout %v isn't longer than the request timeout %v", srv.WriteTimeout, defaultRequestTimeout)
+	}
+	if srv.TLSConfig == nil || srv.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("got TLS config %+v, want at least TLS 1.2", srv.TLSConfig)
+	}
+
+	cfg := defaultConfig()
+	cfg.Addr = "127.0.0.1:8080"
+	if srv := newServer(cfg, h); srv.Addr != "127.0.0.1:8080" {
+		t.Errorf("ADDR 127.0.0.1:8080 gave the address %q", srv.Addr)
+	}
+}
+
+func TestNewServerTimeoutsFromEnvironment(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "3s")
+	t.Setenv("READ_HEADER_TIMEOUT", "1s")
+	t.Setenv("WRITE_TIMEOUT", "500ms")
+	t.Setenv("IDLE_TIMEOUT", "2m")
+
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(cfg, http.NotFoundHandler())
+
+	if srv.ReadTimeout != 3*time.Second || srv.ReadHeaderTimeout != time.Second || srv.WriteTimeout != 500*time.Millisecond || srv.IdleTimeout != 2*time.Minute {
+		t.Errorf("got read %v, read header %v, write %v and idle %v timeouts", srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	t.Setenv("WRITE_TIMEOUT", "soon")
+	if _, err := resolveConfig(flags{}); err == nil {
+		t.Error("WRITE_TIMEOUT=soon gave no error")
+	}
+}
+
+func TestServePortInUse(t *testing.T) {
+	// Another listener already has the port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	cfg := defaultConfig()
+	cfg.Addr = l.Addr().String()
+	err = serve(context.Background(), newServer(cfg, http.HandlerFunc(health)), "", "")
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("serve on a port in use returned %v, want EADDRINUSE", err)
+	}
+	if ready() {
+		t.Error("the server is ready although it couldn't listen")
+	}
+}
+
+func TestServeInvalidCertificate(t *testing.T) {
+	// A certificate that can't be loaded is an error of its own, not a panic
+	shuttingDown = make(chan struct{})
+	cfg := defaultConfig()
+	cfg.Addr = freeAddr(t)
+	dir := t.TempDir()
+	err := serve(context.Background(), newServer(cfg, http.HandlerFunc(health)), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err == nil || errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("serve with missing certificate files returned %v, want an error about the files", err)
+	}
+	if ready() {
+		t.Error("the server is still ready after failing")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+)
+
+// staticFiles serves the files in dir. http.Dir makes sure a path like
+// /static/../main.go can't reach files outside of dir.
+func staticFiles(dir string) http.Handler {
+	return http.FileServer(noListingFS{http.Dir(dir)})
+}
+
+// noListingFS is a http.FileSystem that hides directories without an
+// index.html. http.FileServer would otherwise show a list of all the files
+// in them, including ones that were never meant to be found.
+type noListingFS struct {
+	fs http.FileSystem
+}
+
+func (n noListingFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	/*
+		For a directory the file server shows its index.html if there is one,
+		so only directories without it are reported as not existing, which the
+		file server answers with 404 Not Found.
+	*/
+	if info.IsDir() {
+		index, err := n.fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
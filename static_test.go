@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// staticRouter returns the router with the static files in a temporary
+// directory, which has the given files.
+func staticRouter(t *testing.T, files map[string]string) http.Handler {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.StaticDir = t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(cfg.StaticDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router, err := buildRouter(cfg, testServices(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func TestStaticFiles(t *testing.T) {
+	router := staticRouter(t, map[string]string{
+		"style.css":       "body { color: green; }",
+		"docs/index.html": "<h1>Docs</h1>",
+		"secret/notes.md": "nobody should list me",
+	})
+
+	tests := []struct {
+		target      string
+		status      int
+		body        string
+		contentType string
+	}{
+		{target: "/static/style.css", status: http.StatusOK, body: "body { color: green; }", contentType: "text/css; charset=utf-8"},
+		{target: "/static/docs/", status: http.StatusOK, body: "<h1>Docs</h1>", contentType: "text/html; charset=utf-8"},
+		{target: "/static/secret/", status: http.StatusNotFound},
+		{target: "/static/", status: http.StatusNotFound},
+		{target: "/static/missing.js", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveRequest(router, "GET", tt.target, "")
+			if rec.Code != tt.status {
+				t.Fatalf("GET %s = %d, want %d", tt.target, rec.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("GET %s = %q, want %q", tt.target, rec.Body, tt.body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("GET %s has Content-Type %q, want %q", tt.target, got, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestStaticFilesStayInDirectory(t *testing.T) {
+	// The static directory is inside another one with a file that must stay hidden
+	parent := t.TempDir()
+	cfg := defaultConfig()
+	cfg.StaticDir = filepath.Join(parent, "public")
+	if err := os.Mkdir(cfg.StaticDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(parent, "main.go"), []byte("package secret"), 0o644)
+	os.WriteFile(filepath.Join(cfg.StaticDir, "hello.txt"), []byte("hello there"), 0o644)
+	router, err := buildRouter(cfg, testServices(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serveRequest(router, "GET", "/static/hello.txt", ""); rec.Code != http.StatusOK || rec.Body.String() != "hello there" {
+		t.Errorf("GET /static/hello.txt = %d %q", rec.Code, rec.Body)
+	}
+
+	for _, target := range []string{"/static/../main.go", "/static/..%2fmain.go", "/static/%2e%2e/main.go", "/static/..%5cmain.go"} {
+		rec := serveRequest(router, "GET", target, "")
+		if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "package secret") {
+			t.Errorf("GET %s = %d, it reached the file outside the directory", target, rec.Code)
+		}
+	}
+}
+
+func TestStaticDirFromEnvironment(t *testing.T) {
+	t.Setenv("STATIC_DIR", "")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StaticDir != "public" {
+		t.Errorf("StaticDir defaults to %q, want public", cfg.StaticDir)
+	}
+
+	t.Setenv("STATIC_DIR", "assets")
+	if cfg, err = resolveConfig(flags{}); err != nil || cfg.StaticDir != "assets" {
+		t.Errorf("STATIC_DIR=assets gave %v", err)
+	}
+	if cfg, err = resolveConfig(flags{staticDir: "www"}); err != nil || cfg.StaticDir != "www" {
+		t.Errorf("-static-dir www gave %v, want the flag to win", err)
+	}
+}
@@ -0,0 +1,10 @@
+// Shows the API described by /openapi.json, which the server builds from its routes.
+window.onload = function () {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    // The badge from validator.swagger.io would be a request to another site
+    validatorUrl: null,
+  });
+};
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// textTransforms maps the {mode} of /transform/{mode}/{text} to the function
+// that changes the text.
+var textTransforms = map[string]func(string) string{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func transform(maxBytes int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		/*
+			Just like in print, the text is a dynamic url parameter. The router
+			decodes the path before matching it, so /transform/upper/%C3%85se
+			gives the text "Åse". strings.ToUpper and strings.ToLower work on
+			the characters of the text, not its bytes, so Å becomes å correctly.
+		*/
+		vars := mux.Vars(r)
+		input := vars["text"]
+		if len(input) > maxBytes {
+			writeAPIError(w, r, http.StatusBadRequest, "text_too_long", fmt.Sprintf("text is longer than %d bytes", maxBytes))
+			return
+		}
+
+		change := textTransforms[vars["mode"]]
+		writeSuccess(w, r, http.StatusOK, map[string]string{
+			"input":  input,
+			"output": change(input),
+		})
+	}
+}
+
+func reverse(maxBytes int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := mux.Vars(r)["text"]
+		if len(input) > maxBytes {
+			writeAPIError(w, r, http.StatusBadRequest, "text_too_long", fmt.Sprintf("text is longer than %d bytes", maxBytes))
+			return
+		}
+
+		/*
+			A string in Go is a list of bytes, and a character like Å takes two of
+			them in UTF-8. Reversing the bytes would split it into garbage, so the
+			string is turned into runes first, where every rune is one character.
+
+			Some things a reader sees as one character are several runes, like an
+			e followed by a combining accent, or many emoji. Those still come out
+			in the wrong order, which would need the grapheme rules of Unicode.
+		*/
+		runes := []rune(input)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+
+		writeSuccess(w, r, http.StatusOK, map[string]string{
+			"input":    input,
+			"reversed": string(runes),
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTransform(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		target string
+		input  string
+		output string
+	}{
+		{target: "/transform/upper/Hello%20World", input: "Hello World", output: "HELLO WORLD"},
+		{target: "/transform/lower/Hello%20World", input: "Hello World", output: "hello world"},
+		{target: "/transform/upper/%C3%85se", input: "Åse", output: "ÅSE"},
+		{target: "/transform/lower/%C3%85SE", input: "ÅSE", output: "åse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveRequest(router, "GET", tt.target, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d, want 200\n%s", tt.target, rec.Code, rec.Body)
+			}
+			var got map[string]string
+			decodeData(t, rec, &got)
+			if got["input"] != tt.input || got["output"] != tt.output {
+				t.Errorf("GET %s = %v, want input %q and output %q", tt.target, got, tt.input, tt.output)
+			}
+		})
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	if rec := serveRequest(router, "GET", "/transform/title/yoda", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /transform/title/yoda = %d, want 404 for an unknown mode", rec.Code)
+	}
+
+	target := "/transform/upper/" + strings.Repeat("a", defaultMaxPrintBytes+1)
+	rec := serveRequest(router, "GET", target, "")
+	if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "text_too_long" {
+		t.Errorf("GET with %d bytes = %d %s, want 400 text_too_long", defaultMaxPrintBytes+1, rec.Code, rec.Body)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		target   string
+		input    string
+		reversed string
+	}{
+		{target: "/reverse/hello", input: "hello", reversed: "olleh"},
+		{target: "/reverse/%C3%85se", input: "Åse", reversed: "esÅ"},
+		{target: "/reverse/%E6%97%A5%E6%9C%AC%E8%AA%9E", input: "日本語", reversed: "語本日"},
+		{target: "/reverse/a%F0%9F%91%8Bb", input: "a👋b", reversed: "b👋a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveRequest(router, "GET", tt.target, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d, want 200\n%s", tt.target, rec.Code, rec.Body)
+			}
+			var got map[string]string
+			decodeData(t, rec, &got)
+			if got["input"] != tt.input || got["reversed"] != tt.reversed {
+				t.Errorf("GET %s = %v, want input %q reversed to %q", tt.target, got, tt.input, tt.reversed)
+			}
+			if !utf8.ValidString(got["reversed"]) {
+				t.Errorf("GET %s gave invalid UTF-8 %q", tt.target, got["reversed"])
+			}
+		})
+	}
+
+	target := "/reverse/" + strings.Repeat("a", defaultMaxPrintBytes+1)
+	rec := serveRequest(router, "GET", target, "")
+	if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "text_too_long" {
+		t.Errorf("GET with %d bytes = %d %s, want 400 text_too_long", defaultMaxPrintBytes+1, rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeoutWriter is the ResponseWriter handlers get from timeoutMiddleware. It
+// keeps its own header map, which is copied to the real one when the status
+// is written, and refuses writes after the request has timed out. The mutex
+// is needed because the handler and the middleware run in different goroutines.
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	if tw.wroteHeader || tw.timedOut {
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.w.Header()
+	for key, values := range tw.h {
+		dst[key] = values
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	/*
+		After a hijack the handler owns the connection, so the middleware must
+		not send a 503 on it anymore. Counting it as a written header makes the
+		middleware wait for the handler, like it does for streams.
+	*/
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return http.NewResponseController(tw.w).Hijack()
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// handlerPanic is a panic of a handler that timeoutMiddleware ran in its own
+// goroutine, with the stack of that goroutine. recoverMiddleware logs this
+// stack, since its own only shows the goroutine of the middleware.
+type handlerPanic struct {
+	val   interface{}
+	stack []byte
+}
+
+func timeoutMiddleware(d time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			/*
+				The paths starting with one of the exempt prefixes are meant to take
+				long, like the profiles under /debug/pprof/, so they get no timeout.
+			*/
+			for _, prefix := range exempt {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			/*
+				The handler runs in its own goroutine, so this one can answer when it
+				takes too long. Its context is cancelled on timeout, which tells the
+				handler to stop (e.g. database calls using r.Context() give up).
+			*/
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: http.Header{}}
+			done := make(chan struct{})
+			panics := make(chan handlerPanic, 1)
+			go func() {
+				/*
+					A panic in another goroutine can't be recovered here, so it is
+					passed back. debug.Stack has to be called here, where it still
+					shows the handler that panicked.
+				*/
+				defer func() {
+					if rec := recover(); rec != nil {
+						panics <- handlerPanic{val: rec, stack: debug.Stack()}
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-done:
+				return
+			case p := <-panics:
+				panic(p)
+			case <-timer.C:
+			}
+
+			/*
+				If the handler already started sending its response, e.g. a stream
+				of events, the status can't be changed anymore. Then it is allowed to
+				finish, so streaming responses aren't cut off by the timeout.
+			*/
+			tw.mu.Lock()
+			if tw.wroteHeader {
+				tw.mu.Unlock()
+				select {
+				case <-done:
+				case p := <-panics:
+					panic(p)
+				}
+				return
+			}
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			cancel()
+			writeError(w, r, http.StatusServiceUnavailable, "timeout", "request timeout")
+		})
+	}
+}
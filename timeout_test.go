@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddlewareFires(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- true
+		case <-time.After(time.Second):
+			cancelled <- false
+			writeSuccess(w, r, http.StatusOK, "too late")
+		}
+	})
+
+	rec := serveRequest(timeoutMiddleware(20*time.Millisecond)(slow), "GET", "/slow", "")
+	if apiErr := decodeError(t, rec); rec.Code != http.StatusServiceUnavailable || apiErr.Code != "timeout" || apiErr.Message != "request timeout" {
+		t.Errorf("slow handler = %d %+v, want 503 request timeout", rec.Code, apiErr)
+	}
+	if !<-cancelled {
+		t.Error("the context of the slow handler wasn't cancelled")
+	}
+}
+
+func TestTimeoutMiddlewarePanicStack(t *testing.T) {
+	logs := captureLogs(t)
+	h := recoverMiddleware(timeoutMiddleware(time.Second)(http.HandlerFunc(panicking)))
+
+	rec := serveRequest(h, "GET", "/panic", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking handler = %d, want 500", rec.Code)
+	}
+
+	// The logged stack is the one of the handler's goroutine, not the one of the middleware
+	records := logs()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want the panic", len(records))
+	}
+	stack, _ := records[0]["stack"].(string)
+	if !strings.Contains(stack, ".panicking(") {
+		t.Errorf("the logged stack doesn't show the handler that panicked:\n%s", stack)
+	}
+	if panicText, _ := records[0]["panic"].(string); !strings.Contains(panicText, "nil map") {
+		t.Errorf("logged panic %q, want the panic of the handler", panicText)
+	}
+}
+
+func TestTimeoutMiddlewareInTime(t *testing.T) {
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "yes")
+		writeSuccess(w, r, http.StatusCreated, "in time")
+	})
+
+	rec := serveRequest(timeoutMiddleware(time.Second)(fast), "GET", "/fast", "")
+	var got string
+	decodeData(t, rec, &got)
+	if rec.Code != http.StatusCreated || got != "in time" || rec.Header().Get("X-Fast") != "yes" {
+		t.Errorf("fast handler = %d %q with X-Fast %q, want its own 201 response", rec.Code, got, rec.Header().Get("X-Fast"))
+	}
+}
+
+func TestTimeoutMiddlewareLetsStreamsFinish(t *testing.T) {
+	// The stream starts before the timeout and ends after it
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		time.Sleep(60 * time.Millisecond)
+		w.Write([]byte("last"))
+	})
+
+	rec := serveRequest(timeoutMiddleware(20*time.Millisecond)(stream), "GET", "/stream", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "first last" {
+		t.Errorf("stream = %d %q, want 200 with the whole stream", rec.Code, rec.Body)
+	}
+}
+
+func TestRequestTimeoutFromEnvironment(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "250ms")
+	cfg, err := resolveConfig(flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RequestTimeout.Duration != 250*time.Millisecond {
+		t.Errorf("REQUEST_TIMEOUT=250ms gave %v", cfg.RequestTimeout.Duration)
+	}
+
+	for _, value := range []string{"soon", "0s"} {
+		t.Setenv("REQUEST_TIMEOUT", value)
+		if _, err := resolveConfig(flags{}); err == nil {
+			t.Errorf("REQUEST_TIMEOUT=%s gave no error", value)
+		}
+	}
+}
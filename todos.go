@@ -0,0 +1,216 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// todo is a task on the list kept by the /todos endpoints.
+type todo struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Done      bool      `json:"done"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TodoRepository is where the todos are stored. The handlers only use this
+// interface, so they work the same with every implementation: the in-memory
+// one from newMemoryTodos, or SQLite from openSQLiteTodos when DB_PATH is set.
+// Get, Update and Delete return false when there is no todo with the ID.
+type TodoRepository interface {
+	Create(title string, done bool) (todo, error)
+	List(limit, offset int) (todos []todo, total int, err error)
+	Get(id int) (todo, bool, error)
+	Update(id int, title string, done bool) (todo, bool, error)
+	Delete(id int) (bool, error)
+	Count() (int, error)
+}
+
+// memoryTodos keeps todos in memory, in the same way as noteStore keeps
+// notes. They are lost when the program stops.
+type memoryTodos struct {
+	mu     sync.RWMutex
+	todos  map[int]todo
+	nextID int
+}
+
+func newMemoryTodos() *memoryTodos {
+	return &memoryTodos{todos: map[int]todo{}, nextID: 1}
+}
+
+func (m *memoryTodos) Create(title string, done bool) (todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := todo{ID: m.nextID, Title: title, Done: done, CreatedAt: time.Now().UTC()}
+	m.todos[t.ID] = t
+	m.nextID++
+	return t, nil
+}
+
+func (m *memoryTodos) List(limit, offset int) ([]todo, int, error) {
+	m.mu.RLock()
+	todos := make([]todo, 0, len(m.todos))
+	for _, t := range m.todos {
+		todos = append(todos, t)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	start, end := pageBounds(len(todos), limit, offset)
+	return todos[start:end], len(todos), nil
+}
+
+func (m *memoryTodos) Get(id int) (todo, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, exists := m.todos[id]
+	return t, exists, nil
+}
+
+func (m *memoryTodos) Update(id int, title string, done bool) (todo, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, exists := m.todos[id]
+	if !exists {
+		return todo{}, false, nil
+	}
+	t.Title = title
+	t.Done = done
+	m.todos[id] = t
+	return t, true, nil
+}
+
+func (m *memoryTodos) Delete(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.todos[id]; !exists {
+		return false, nil
+	}
+	delete(m.todos, id)
+	return true, nil
+}
+
+func (m *memoryTodos) Count() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.todos), nil
+}
+
+// todoAPI has the handlers of the /todos endpoints.
+type todoAPI struct {
+	repo TodoRepository
+}
+
+// todoInput is the JSON body accepted when creating or updating a todo. An
+// update replaces both fields, like PUT does for the other resources.
+type todoInput struct {
+	Title string `json:"title" validate:"required,max=200"`
+	Done  bool   `json:"done"`
+}
+
+// writeStorageError answers a request whose todos couldn't be read or
+// stored. The error itself goes to the log, since it can show details about
+// the database the client has no business knowing.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	logger.Error("todo storage failed", "request_id", requestIDFromContext(r.Context()), "error", err)
+	writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "could not access the todos")
+}
+
+func (api *todoAPI) create(w http.ResponseWriter, r *http.Request) {
+	var input todoInput
+	if err := decodeAndValidate(r, &input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	t, err := api.repo.Create(input.Title, input.Done)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeSuccess(w, r, http.StatusCreated, t)
+}
+
+func (api *todoAPI) list(w http.ResponseWriter, r *http.Request) {
+	/*
+		A list can get long, so it's sent in pages, e.g. ?limit=10&offset=20
+		for the third page of 10. The meta part of the response tells how many
+		todos there are in total, so a client knows when it has them all.
+	*/
+	limit, offset, err := pageQuery(r)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	todos, total, err := api.repo.List(limit, offset)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, APIResponse{
+		Data: todos,
+		Meta: page{Total: total, Limit: limit, Offset: offset},
+	})
+}
+
+func (api *todoAPI) get(w http.ResponseWriter, r *http.Request) {
+	// mux.Vars gives the path variables as strings, and the route only matches digits
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	t, exists, err := api.repo.Get(id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "todo_not_found", "todo not found")
+		return
+	}
+	writeSuccess(w, r, http.StatusOK, t)
+}
+
+func (api *todoAPI) update(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var input todoInput
+	if err := decodeAndValidate(r, &input); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	t, exists, err := api.repo.Update(id, input.Title, input.Done)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "todo_not_found", "todo not found")
+		return
+	}
+	writeSuccess(w, r, http.StatusOK, t)
+}
+
+func (api *todoAPI) delete(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	exists, err := api.repo.Delete(id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if !exists {
+		writeAPIError(w, r, http.StatusNotFound, "todo_not_found", "todo not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	// The sqlite driver is written in pure Go, so the program still builds
+	// without a C compiler. Importing it registers the "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTodos stores todos in a SQLite database file, so they are still
+// there after a restart.
+type sqliteTodos struct {
+	db *sql.DB
+}
+
+// todoSchema creates the todos table when the database doesn't have it yet.
+// AUTOINCREMENT makes sure IDs are never reused, like in memoryTodos.
+const todoSchema = `
+CREATE TABLE IF NOT EXISTS todos (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	title      TEXT    NOT NULL,
+	done       INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT    NOT NULL
+)`
+
+// openSQLiteTodos opens (or creates) the database at path and makes sure it
+// has the todos table.
+func openSQLiteTodos(path string) (*sqliteTodos, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		SQLite allows only one writer at a time, and every connection to
+		":memory:" would get its own empty database, so a single connection is
+		shared by all requests. That's plenty for this API.
+	*/
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(todoSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteTodos{db: db}, nil
+}
+
+func (s *sqliteTodos) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteTodos) Create(title string, done bool) (todo, error) {
+	/*
+		The ? in the queries are placeholders, which the database fills in with
+		the arguments. Never put values into the SQL text itself, since a title
+		like '); DROP TABLE todos; -- would then be run as SQL.
+	*/
+	t := todo{Title: title, Done: done, CreatedAt: time.Now().UTC()}
+	result, err := s.db.Exec(
+		"INSERT INTO todos (title, done, created_at) VALUES (?, ?, ?)",
+		t.Title, t.Done, t.CreatedAt.Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return todo{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return todo{}, err
+	}
+	t.ID = int(id)
+	return t, nil
+}
+
+func (s *sqliteTodos) List(limit, offset int) ([]todo, int, error) {
+	total, err := s.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT id, title, done, created_at FROM todos ORDER BY id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	todos := []todo{}
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, total, rows.Err()
+}
+
+func (s *sqliteTodos) Get(id int) (todo, bool, error) {
+	row := s.db.QueryRow("SELECT id, title, done, created_at FROM todos WHERE id = ?", id)
+	t, err := scanTodo(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo{}, false, nil
+	}
+	if err != nil {
+		return todo{}, false, err
+	}
+	return t, true, nil
+}
+
+func (s *sqliteTodos) Update(id int, title string, done bool) (todo, bool, error) {
+	result, err := s.db.Exec("UPDATE todos SET title = ?, done = ? WHERE id = ?", title, done, id)
+	if err != nil {
+		return todo{}, false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return todo{}, false, err
+	}
+	return s.Get(id)
+}
+
+func (s *sqliteTodos) Delete(id int) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM todos WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqliteTodos) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM todos").Scan(&n)
+	return n, err
+}
+
+// scanner is the Scan method that both *sql.Row and *sql.Rows have.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTodo reads one todo from the result of a query.
+func scanTodo(row scanner) (todo, error) {
+	var t todo
+	var createdAt string
+	if err := row.Scan(&t.ID, &t.Title, &t.Done, &createdAt); err != nil {
+		return todo{}, err
+	}
+
+	var err error
+	t.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	return t, err
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestTodoAPI(t *testing.T) {
+	// The steps run in order on the same list, like in TestKVStore
+	router := newV1Router(t, testServices(t))
+	steps := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantErr  string
+		want     *todo
+	}{
+		{name: "create", method: "POST", target: "/todos", body: `{"title": "Lift the X-wing"}`, wantCode: http.StatusCreated, want: &todo{ID: 1, Title: "Lift the X-wing"}},
+		{name: "create done", method: "POST", target: "/todos", body: `{"title": "Eat", "done": true}`, wantCode: http.StatusCreated, want: &todo{ID: 2, Title: "Eat", Done: true}},
+		{name: "create without title", method: "POST", target: "/todos", body: `{"done": true}`, wantCode: http.StatusBadRequest, wantErr: "validation_failed"},
+		{name: "create invalid JSON", method: "POST", target: "/todos", body: `{"title":`, wantCode: http.StatusBadRequest, wantErr: "invalid_json"},
+		{name: "get", method: "GET", target: "/todos/1", wantCode: http.StatusOK, want: &todo{ID: 1, Title: "Lift the X-wing"}},
+		{name: "get missing", method: "GET", target: "/todos/99", wantCode: http.StatusNotFound, wantErr: "todo_not_found"},
+		{name: "update", method: "PUT", target: "/todos/1", body: `{"title": "Lift the X-wing", "done": true}`, wantCode: http.StatusOK, want: &todo{ID: 1, Title: "Lift the X-wing", Done: true}},
+		{name: "get updated", method: "GET", target: "/todos/1", wantCode: http.StatusOK, want: &todo{ID: 1, Title: "Lift the X-wing", Done: true}},
+		{name: "update missing", method: "PUT", target: "/todos/99", body: `{"title": "x"}`, wantCode: http.StatusNotFound, wantErr: "todo_not_found"},
+		{name: "update without title", method: "PUT", target: "/todos/1", body: `{"done": false}`, wantCode: http.StatusBadRequest, wantErr: "validation_failed"},
+		{name: "delete", method: "DELETE", target: "/todos/1", wantCode: http.StatusNoContent},
+		{name: "get deleted", method: "GET", target: "/todos/1", wantCode: http.StatusNotFound, wantErr: "todo_not_found"},
+		{name: "delete missing", method: "DELETE", target: "/todos/1", wantCode: http.StatusNotFound, wantErr: "todo_not_found"},
+	}
+	for _, step := range steps {
+		rec := serveRequest(router, step.method, step.target, step.body)
+		if rec.Code != step.wantCode {
+			t.Fatalf("%s: %s %s = %d, want %d\n%s", step.name, step.method, step.target, rec.Code, step.wantCode, rec.Body)
+		}
+		if step.wantErr != "" {
+			if got := decodeError(t, rec).Code; got != step.wantErr {
+				t.Errorf("%s: error code = %q, want %q", step.name, got, step.wantErr)
+			}
+		}
+		if step.want != nil {
+			var got todo
+			decodeData(t, rec, &got)
+			if got.CreatedAt.IsZero() {
+				t.Errorf("%s: the todo has no created_at", step.name)
+			}
+			got.CreatedAt = step.want.CreatedAt
+			if got != *step.want {
+				t.Errorf("%s: got %+v, want %+v", step.name, got, *step.want)
+			}
+		}
+	}
+}
+
+func TestTodoPagination(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+	for i := 1; i <= 25; i++ {
+		serveRequest(router, "POST", "/todos", fmt.Sprintf(`{"title": "todo %d"}`, i))
+	}
+
+	tests := []struct {
+		query     string
+		wantIDs   []int
+		wantLimit int
+		wantOff   int
+	}{
+		{query: "", wantIDs: ids(1, 20), wantLimit: defaultPageLimit},
+		{query: "?limit=5", wantIDs: ids(1, 5), wantLimit: 5},
+		{query: "?limit=5&offset=10", wantIDs: ids(11, 15), wantLimit: 5, wantOff: 10},
+		{query: "?limit=10&offset=20", wantIDs: ids(21, 25), wantLimit: 10, wantOff: 20},
+		{query: "?offset=25", wantIDs: nil, wantLimit: defaultPageLimit, wantOff: 25},
+		{query: "?offset=1000", wantIDs: nil, wantLimit: defaultPageLimit, wantOff: 1000},
+		{query: "?limit=100", wantIDs: ids(1, 25), wantLimit: maxPageLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serveRequest(router, "GET", "/todos"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /todos%s = %d, want 200\n%s", tt.query, rec.Code, rec.Body)
+			}
+
+			var body struct {
+				Data []todo `json:"data"`
+				Meta page   `json:"meta"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("could not decode %s: %v", rec.Body, err)
+			}
+			if want := (page{Total: 25, Limit: tt.wantLimit, Offset: tt.wantOff}); body.Meta != want {
+				t.Errorf("meta = %+v, want %+v", body.Meta, want)
+			}
+
+			// An empty page is an empty list, not null
+			if body.Data == nil {
+				t.Fatalf("data is not a list: %s", rec.Body)
+			}
+			var got []int
+			for _, todo := range body.Data {
+				got = append(got, todo.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("got the todos %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?limit=ten", "?offset=-1"} {
+		rec := serveRequest(router, "GET", "/todos"+query, "")
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_query" {
+			t.Errorf("GET /todos%s = %d %s, want 400 invalid_query", query, rec.Code, rec.Body)
+		}
+	}
+}
+
+// ids returns the numbers from first to last.
+func ids(first, last int) []int {
+	var ids []int
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// The same tests run against every TodoRepository, so both behave the same
+// behind the handlers.
+func TestTodoRepositories(t *testing.T) {
+	repos := map[string]func(t *testing.T) TodoRepository{
+		"memory": func(t *testing.T) TodoRepository { return newMemoryTodos() },
+		"sqlite": func(t *testing.T) TodoRepository {
+			db, err := openSQLiteTodos(filepath.Join(t.TempDir(), "todos.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			return db
+		},
+	}
+	for name, open := range repos {
+		t.Run(name, func(t *testing.T) {
+			t.Run("lifecycle", func(t *testing.T) { testTodoLifecycle(t, open(t)) })
+			t.Run("missing", func(t *testing.T) { testTodoMissing(t, open(t)) })
+			t.Run("list", func(t *testing.T) { testTodoList(t, open(t)) })
+		})
+	}
+}
+
+func testTodoLifecycle(t *testing.T, repo TodoRepository) {
+	created, err := repo.Create("Lift the X-wing", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 1 || created.Title != "Lift the X-wing" || created.Done || created.CreatedAt.IsZero() {
+		t.Fatalf("Create gave %+v, want todo 1", created)
+	}
+
+	got, exists, err := repo.Get(created.ID)
+	if err != nil || !exists || got.Title != created.Title || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Get(1) = %+v, %v, %v, want %+v", got, exists, err, created)
+	}
+
+	updated, exists, err := repo.Update(created.ID, "Lift the X-wing with the Force", true)
+	if err != nil || !exists || updated.Title != "Lift the X-wing with the Force" || !updated.Done || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Update(1) = %+v, %v, %v, want the new title and done with the same created_at", updated, exists, err)
+	}
+
+	if deleted, err := repo.Delete(created.ID); err != nil || !deleted {
+		t.Errorf("Delete(1) = %v, %v, want true", deleted, err)
+	}
+	if _, exists, err := repo.Get(created.ID); err != nil || exists {
+		t.Errorf("Get(1) after the delete = %v, %v, want it gone", exists, err)
+	}
+
+	// IDs are never reused, even after a delete
+	if next, err := repo.Create("Eat", false); err != nil || next.ID != 2 {
+		t.Errorf("the next Create gave %+v, %v, want todo 2", next, err)
+	}
+}
+
+func testTodoMissing(t *testing.T, repo TodoRepository) {
+	if _, exists, err := repo.Get(99); err != nil || exists {
+		t.Errorf("Get(99) = %v, %v, want false", exists, err)
+	}
+	if _, exists, err := repo.Update(99, "x", false); err != nil || exists {
+		t.Errorf("Update(99) = %v, %v, want false", exists, err)
+	}
+	if deleted, err := repo.Delete(99); err != nil || deleted {
+		t.Errorf("Delete(99) = %v, %v, want false", deleted, err)
+	}
+	if n, err := repo.Count(); err != nil || n != 0 {
+		t.Errorf("Count() = %d, %v, want 0", n, err)
+	}
+}
+
+func testTodoList(t *testing.T, repo TodoRepository) {
+	for i := 0; i < 5; i++ {
+		if _, err := repo.Create("todo", i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		limit, offset int
+		wantIDs       []int
+	}{
+		{limit: 10, offset: 0, wantIDs: ids(1, 5)},
+		{limit: 2, offset: 0, wantIDs: ids(1, 2)},
+		{limit: 2, offset: 3, wantIDs: ids(4, 5)},
+		{limit: 2, offset: 5, wantIDs: nil},
+	}
+	for _, tt := range tests {
+		todos, total, err := repo.List(tt.limit, tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, todo := range todos {
+			got = append(got, todo.ID)
+		}
+		if total != 5 || fmt.Sprint(got) != fmt.Sprint(tt.wantIDs) {
+			t.Errorf("List(%d, %d) = %v of %d, want %v of 5", tt.limit, tt.offset, got, total, tt.wantIDs)
+		}
+	}
+	if n, err := repo.Count(); err != nil || n != 5 {
+		t.Errorf("Count() = %d, %v, want 5", n, err)
+	}
+}
+
+func TestSQLiteTodosPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.db")
+	db, err := openSQLiteTodos(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := db.Create("Lift the X-wing", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The todo is still there when the database is opened again, like after a restart
+	db, err = openSQLiteTodos(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, exists, err := db.Get(created.ID)
+	if err != nil || !exists || got.Title != created.Title || !got.Done || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Get(%d) after reopening = %+v, %v, %v, want %+v", created.ID, got, exists, err, created)
+	}
+}
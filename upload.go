@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// uploadMemoryBytes is how much of an upload ParseMultipartForm keeps in
+// memory. Anything larger is written to a temporary file first.
+const uploadMemoryBytes = 1 << 20
+
+// allowedUploadTypes are the kinds of files POST /upload accepts, with the
+// extension the stored file gets.
+var allowedUploadTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+func upload(dir string, maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		/*
+			A multipart form is how browsers send files, with every field of the
+			form as its own part. The size of the whole request is limited by
+			maxBodyBytesMiddleware, so a request that is too large fails here with 413.
+		*/
+		if err := r.ParseMultipartForm(uploadMemoryBytes); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeReadError(w, r, err)
+				return
+			}
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_form", "invalid multipart form: "+err.Error())
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "missing_file", "the form needs a file in the field \"file\"")
+			return
+		}
+		defer file.Close()
+
+		// The file itself has its own limit, which can be smaller than the one for the request
+		if header.Size > maxBytes {
+			writeAPIError(w, r, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("the file is larger than %d bytes", maxBytes))
+			return
+		}
+
+		/*
+			The Content-Type the client sends for the file can be anything, so the
+			type is found from the first 512 bytes of the file itself instead.
+			http.DetectContentType returns e.g. "text/plain; charset=utf-8", and
+			mime.ParseMediaType removes the part after the semicolon.
+		*/
+		head := make([]byte, 512)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_file", "could not read the uploaded file")
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+		extension, ok := allowedUploadTypes[contentType]
+		if !ok {
+			writeAPIError(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "files of type "+contentType+" are not allowed")
+			return
+		}
+
+		// Seek goes back to the start of the file, so the bytes read above are stored too
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_file", "could not read the uploaded file")
+			return
+		}
+
+		/*
+			The name the client gave the file is never used for storing it, since
+			a name like "../main.go" could overwrite files outside the directory.
+			A random UUID can't contain slashes or dots, so it is always safe.
+		*/
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "could not store the file")
+			return
+		}
+		filename := newUUID() + extension
+		dst, err := os.OpenFile(filepath.Join(dir, filename), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "could not store the file")
+			return
+		}
+		defer dst.Close()
+
+		size, err := io.Copy(dst, file)
+		if err != nil {
+			os.Remove(dst.Name())
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "could not store the file")
+			return
+		}
+
+		writeSuccess(w, r, http.StatusCreated, map[string]interface{}{
+			"filename":     filename,
+			"size":         size,
+			"content_type": contentType,
+		})
+	}
+}
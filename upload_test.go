@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// postFile sends a multipart form to h with content as a file in the field
+// called field.
+func postFile(t *testing.T, h http.Handler, field, filename string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// uploadResponse is the data of POST /upload.
+type uploadResponse struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+func TestUploadStoresFile(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("Do or do not, there is no try.\n")
+
+	// The name from the client is ignored, so it can't point outside the directory
+	rec := postFile(t, upload(dir, 1024), "file", "../../quote.txt", content)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /upload = %d, want 201\n%s", rec.Code, rec.Body)
+	}
+
+	var data uploadResponse
+	decodeData(t, rec, &data)
+	if data.Size != int64(len(content)) || data.ContentType != "text/plain" || filepath.Ext(data.Filename) != ".txt" {
+		t.Errorf("got %+v", data)
+	}
+	if filepath.Base(data.Filename) != data.Filename {
+		t.Errorf("the stored name %q is not a plain file name", data.Filename)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(dir, data.Filename))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("the stored file has %q, %v, want the upload", stored, err)
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	rec := postFile(t, upload(dir, 16), "file", "big.txt", bytes.Repeat([]byte("a"), 17))
+	if rec.Code != http.StatusRequestEntityTooLarge || decodeError(t, rec).Code != "file_too_large" {
+		t.Errorf("a file one byte over the limit = %d %s, want 413 file_too_large", rec.Code, rec.Body)
+	}
+
+	// Nothing is stored for a refused file
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("the upload directory has %d files, want none", len(entries))
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	dir := t.TempDir()
+	h := upload(dir, 1024)
+
+	t.Run("small png", func(t *testing.T) {
+		png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+		rec := postFile(t, h, "file", "x.png", png)
+		var data uploadResponse
+		decodeData(t, rec, &data)
+		if rec.Code != http.StatusCreated || data.ContentType != "image/png" || filepath.Ext(data.Filename) != ".png" {
+			t.Errorf("a small png = %d %+v, want 201 image/png", rec.Code, data)
+		}
+	})
+
+	t.Run("body over MAX_BODY_BYTES", func(t *testing.T) {
+		// The request limit is smaller than the one for files here
+		rec := postFile(t, maxBodyBytesMiddleware(256)(h), "file", "big.txt", bytes.Repeat([]byte("a"), 512))
+		if rec.Code != http.StatusRequestEntityTooLarge || decodeError(t, rec).Code != "body_too_large" {
+			t.Errorf("got %d %s, want 413 body_too_large", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		rec := postFile(t, h, "document", "quote.txt", []byte("hello"))
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "missing_file" {
+			t.Errorf("got %d %s, want 400 missing_file", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("not a form", func(t *testing.T) {
+		rec := serveRequest(h, "POST", "/upload", `{"file": "hello"}`)
+		if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != "invalid_form" {
+			t.Errorf("got %d %s, want 400 invalid_form", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		// The type comes from the content, so calling it .txt doesn't help
+		rec := postFile(t, h, "file", "page.txt", []byte("<html><script>alert(1)</script></html>"))
+		if rec.Code != http.StatusUnsupportedMediaType || decodeError(t, rec).Code != "unsupported_media_type" {
+			t.Errorf("got %d %s, want 415 unsupported_media_type", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+func newUUID() string {
+	/*
+		A version 4 UUID is 16 random bytes where a few bits are set to fixed
+		values to mark the version (4) and the variant. crypto/rand gives random
+		bytes that can't be predicted, unlike math/rand.
+	*/
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func getUUID(w http.ResponseWriter, r *http.Request) {
+	/*
+		Without a count query parameter a single UUID is returned. With e.g.
+		?count=5 a list of that many UUIDs is returned under "uuids" instead.
+	*/
+	if !r.URL.Query().Has("count") {
+		writeSuccess(w, r, http.StatusOK, map[string]string{"uuid": newUUID()})
+		return
+	}
+
+	count, err := requireIntQuery(r, "count", 1, 100)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	uuids := make([]string, count)
+	for i := range uuids {
+		uuids[i] = newUUID()
+	}
+	writeSuccess(w, r, http.StatusOK, map[string][]string{"uuids": uuids})
+}
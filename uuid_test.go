@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+// uuidPattern matches a version 4 UUID with the variant bits set.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDSingle(t *testing.T) {
+	rec := serveRequest(http.HandlerFunc(getUUID), "GET", "/uuid", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /uuid = %d, want 200", rec.Code)
+	}
+	var data map[string]string
+	decodeData(t, rec, &data)
+	if !uuidPattern.MatchString(data["uuid"]) {
+		t.Errorf("got uuid %q, want a version 4 UUID", data["uuid"])
+	}
+}
+
+func TestUUIDCount(t *testing.T) {
+	rec := serveRequest(http.HandlerFunc(getUUID), "GET", "/uuid?count=20", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /uuid?count=20 = %d, want 200", rec.Code)
+	}
+	var data map[string][]string
+	decodeData(t, rec, &data)
+	if len(data["uuids"]) != 20 {
+		t.Fatalf("got %d uuids, want 20", len(data["uuids"]))
+	}
+
+	seen := map[string]bool{}
+	for _, id := range data["uuids"] {
+		if !uuidPattern.MatchString(id) || seen[id] {
+			t.Errorf("got uuid %q, want a new version 4 UUID", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestUUIDInvalidCount(t *testing.T) {
+	for _, count := range []string{"0", "101", "-1", "five", ""} {
+		rec := serveRequest(http.HandlerFunc(getUUID), "GET", "/uuid?count="+count, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /uuid?count=%s = %d, want 400", count, rec.Code)
+			continue
+		}
+		if got := decodeError(t, rec).Code; got != "invalid_query" {
+			t.Errorf("GET /uuid?count=%s gave code %q, want invalid_query", count, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks request structs against the rules in their validate tags,
+// e.g. `validate:"required,max=256"`. It caches what it learns about each
+// struct type, so a single one is shared by all handlers.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Errors name the field like the client wrote it in the JSON, not like the Go struct field
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// fieldError describes one field of a request body that broke a rule.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// decodeAndValidate decodes the JSON body of r into dst, which must be a
+// pointer to a struct, and checks the rules in its validate tags. The error
+// can be passed to writeDecodeError as it is.
+func decodeAndValidate(r *http.Request, dst interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return err
+	}
+	return validate.Struct(dst)
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	/*
+		Every failing field is listed, so a client can fix all of them at once
+		instead of finding them one request at a time.
+	*/
+	details := make([]fieldError, len(errs))
+	for i, fe := range errs {
+		details[i] = fieldError{Field: fe.Field(), Rule: fe.Tag(), Message: validationMessage(fe)}
+	}
+	if problemJSON {
+		writeProblemJSON(w, r, problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(http.StatusBadRequest),
+			Status:   http.StatusBadRequest,
+			Detail:   "the request body is invalid",
+			Instance: r.URL.Path,
+			Details:  details,
+		})
+		return
+	}
+	writeJSON(w, r, http.StatusBadRequest, map[string]APIError{
+		"error": {Code: "validation_failed", Message: "the request body is invalid", Details: details},
+	})
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters long", fe.Field(), fe.Param())
+	}
+	return fmt.Sprintf("%s does not pass the %s rule", fe.Field(), fe.Tag())
+}
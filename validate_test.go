@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKVCreateValidation(t *testing.T) {
+	router := newV1Router(t, testServices(t))
+
+	tests := []struct {
+		name string
+		body string
+		want []fieldError
+	}{
+		{
+			name: "missing key",
+			body: `{"value": "yoda"}`,
+			want: []fieldError{{Field: "key", Rule: "required", Message: "key is required"}},
+		},
+		{
+			name: "too long value",
+			body: `{"key": "name", "value": "` + strings.Repeat("a", 4097) + `"}`,
+			want: []fieldError{{Field: "value", Rule: "max", Message: "value must be at most 4096 characters long"}},
+		},
+		{
+			// Every failing field is listed at once
+			name: "both",
+			body: `{"key": "` + strings.Repeat("k", 257) + `", "value": "` + strings.Repeat("a", 4097) + `"}`,
+			want: []fieldError{
+				{Field: "key", Rule: "max", Message: "key must be at most 256 characters long"},
+				{Field: "value", Rule: "max", Message: "value must be at most 4096 characters long"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(router, "POST", "/kv", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("POST /kv = %d, want 400", rec.Code)
+			}
+			apiErr := decodeError(t, rec)
+			if apiErr.Code != "validation_failed" || !reflect.DeepEqual(apiErr.Details, tt.want) {
+				t.Errorf("got %+v, want validation_failed with %+v", apiErr, tt.want)
+			}
+		})
+	}
+
+	// A value of exactly the largest length is fine
+	body := `{"key": "name", "value": "` + strings.Repeat("a", 4096) + `"}`
+	if rec := serveRequest(router, "POST", "/kv", body); rec.Code != http.StatusCreated {
+		t.Errorf("POST /kv with 4096 characters = %d, want 201\n%s", rec.Code, rec.Body)
+	}
+}
+
+func TestPostHelloValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    int
+		wantErr     string
+		wantMessage string
+		wantDetails []fieldError
+	}{
+		{name: "valid", body: `{"name": "Yoda"}`, wantCode: http.StatusOK},
+		{
+			name:        "missing name",
+			body:        `{}`,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "validation_failed",
+			wantDetails: []fieldError{{Field: "name", Rule: "required", Message: "name is required"}},
+		},
+		{
+			name:        "empty name",
+			body:        `{"name": ""}`,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "validation_failed",
+			wantDetails: []fieldError{{Field: "name", Rule: "required", Message: "name is required"}},
+		},
+		{
+			name:        "too long name",
+			body:        `{"name": "` + strings.Repeat("a", 101) + `"}`,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "validation_failed",
+			wantDetails: []fieldError{{Field: "name", Rule: "max", Message: "name must be at most 100 characters long"}},
+		},
+		{
+			name:        "extra field",
+			body:        `{"name": "Yoda", "planet": "Dagobah"}`,
+			wantCode:    http.StatusBadRequest,
+			wantErr:     "unknown_field",
+			wantMessage: `the field "planet" is not allowed`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(http.HandlerFunc(postHello), "POST", "/hello", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("POST /hello = %d, want %d\n%s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantErr == "" {
+				var data struct {
+					Greeting string `json:"greeting"`
+				}
+				decodeData(t, rec, &data)
+				if data.Greeting != "Hello, Yoda!" {
+					t.Errorf("greeting = %q, want Hello, Yoda!", data.Greeting)
+				}
+				return
+			}
+
+			apiErr := decodeError(t, rec)
+			if apiErr.Code != tt.wantErr || !reflect.DeepEqual(apiErr.Details, tt.wantDetails) {
+				t.Errorf("got %+v, want %s with %+v", apiErr, tt.wantErr, tt.wantDetails)
+			}
+			if tt.wantMessage != "" && apiErr.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", apiErr.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// version, commit and buildDate describe the build of the program. They are
+// "dev" when running with go run, and can be set when building with
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// -X can only set string variables, which is why they aren't constants.
+var (
+	version   = "dev"
+	commit    = "dev"
+	buildDate = "dev"
+)
+
+func getVersion(w http.ResponseWriter, r *http.Request) {
+	writeSuccess(w, r, http.StatusOK, map[string]string{
+		"version":    version,
+		"commit":     commit,
+		"build_date": buildDate,
+		"go_version": runtime.Version(),
+	})
+}
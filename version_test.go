@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+// readVersion returns the data of GET /version.
+func readVersion(t *testing.T) map[string]string {
+	t.Helper()
+	rec := serveRequest(http.HandlerFunc(getVersion), "GET", "/version", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /version = %d, want 200", rec.Code)
+	}
+	var data map[string]string
+	decodeData(t, rec, &data)
+	return data
+}
+
+func TestVersionDefaults(t *testing.T) {
+	data := readVersion(t)
+	for _, key := range []string{"version", "commit", "build_date"} {
+		if data[key] != "dev" {
+			t.Errorf("%s = %q, want dev", key, data[key])
+		}
+	}
+	if data["go_version"] != runtime.Version() {
+		t.Errorf("go_version = %q, want %q", data["go_version"], runtime.Version())
+	}
+}
+
+func TestVersionFromBuild(t *testing.T) {
+	// This is what -ldflags "-X main.version=..." does when building
+	version, commit, buildDate = "1.2.0", "abc1234", "2024-05-04T12:00:00Z"
+	t.Cleanup(func() { version, commit, buildDate = "dev", "dev", "dev" })
+
+	data := readVersion(t)
+	if data["version"] != "1.2.0" || data["commit"] != "abc1234" || data["build_date"] != "2024-05-04T12:00:00Z" {
+		t.Errorf("got %v, want the values set for the build", data)
+	}
+}
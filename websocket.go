@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Limits for the WebSocket connections of /ws/echo.
+const (
+	wsMaxMessageBytes = 64 << 10         // the largest message a client may send, 64 KiB
+	wsReadTimeout     = 60 * time.Second // how long the connection may be silent
+	wsWriteTimeout    = 10 * time.Second // how long sending a message may take
+)
+
+// upgrader turns an HTTP request into a WebSocket connection. By default it
+// only accepts requests from web pages on the same host as the API, so other
+// websites can't open connections in the name of a visitor.
+var upgrader = websocket.Upgrader{}
+
+func wsEcho(w http.ResponseWriter, r *http.Request) {
+	/*
+		Upgrade answers the request with 101 Switching Protocols and takes over
+		the connection. From then on both sides can send messages at any time.
+		When it fails it has already sent an error response to the client.
+	*/
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	/*
+		The connection is no longer managed by the http.Server, so it needs its
+		own limits: without a read deadline a client that never sends anything
+		would keep it open forever.
+	*/
+	conn.SetReadLimit(wsMaxMessageBytes)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		/*
+			ReadMessage waits for the next message, which is either text or binary.
+			When the client closes the connection it returns an error, after the
+			library has answered the close message, so the loop just stops.
+		*/
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Debug("websocket closed", "request_id", requestIDFromContext(r.Context()), "error", err.Error())
+			}
+			return
+		}
+
+		// The message is sent back with the same type it came with
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(messageType, message); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketEcho(t *testing.T) {
+	// The whole handler is used, because the middleware has to let the upgrade through
+	shared := testServices(t)
+	router, err := buildRouter(defaultConfig(), shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newHandler(defaultConfig(), router, shared))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws/echo"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close()
+
+	messages := []struct {
+		messageType int
+		data        []byte
+	}{
+		{messageType: websocket.TextMessage, data: []byte("Do or do not, there is no try")},
+		{messageType: websocket.BinaryMessage, data: []byte{0, 1, 2, 255}},
+	}
+	for _, m := range messages {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := conn.WriteMessage(m.messageType, m.data); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != m.messageType || !bytes.Equal(data, m.data) {
+			t.Errorf("sent %d %q, got %d %q back", m.messageType, m.data, messageType, data)
+		}
+	}
+
+	// The server answers the close message, which ends the connection normally
+	closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye")
+	if err := conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("got %v after closing, want a normal close", err)
+	}
+}
+
+func TestWebSocketMessageTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(wsEcho))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, wsMaxMessageBytes+1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("got %v after a too large message, want close 1009", err)
+	}
+}